@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -13,8 +16,11 @@ import (
 type App struct {
 	ctx        context.Context
 	db         *Database
-	thumbDir   string
 	fileServer *LocalFileServer
+	watcher    *WatchManager
+	thumbnails *ThumbnailRenderer
+	// done is closed at shutdown to stop background work.
+	done chan struct{}
 }
 
 // NewApp creates a new App application struct
@@ -27,14 +33,6 @@ func NewApp() *App {
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
-	dataHome := os.Getenv("XDG_DATA_HOME")
-	if dataHome == "" {
-		home, _ := os.UserHomeDir()
-		dataHome = filepath.Join(home, ".local", "share")
-	}
-	a.thumbDir = filepath.Join(dataHome, "sushi", "thumbnails")
-	os.MkdirAll(a.thumbDir, 0755)
-
 	// Open database
 	db, err := NewDatabase()
 	if err != nil {
@@ -44,14 +42,53 @@ func (a *App) startup(ctx context.Context) {
 	a.db = db
 
 	// Start the local file server on its own port
-	a.fileServer = StartLocalFileServer()
-
-	// Scan all existing watch folders on startup
-	go ScanAllFolders(a.db)
+	a.fileServer = StartLocalFileServer(a.db)
+	a.db.SetThumbnailBaseURL(a.fileServer.ThumbnailBaseURL())
+
+	emit := func(name string, data interface{}) {
+		runtime.EventsEmit(a.ctx, name, data)
+	}
+	a.thumbnails = NewThumbnailRenderer(a.db, emit)
+	a.done = make(chan struct{})
+	go a.backUpPeriodically()
+
+	// Watch folders for live changes, then catch up on anything missed while closed.
+	// New and changed files get background thumbnails when the CPU renderer is on.
+	a.watcher = NewWatchManager(a.db, func(name string, data interface{}) {
+		emit(name, data)
+		if name == EventAssetsChanged {
+			a.thumbnails.QueueMissing()
+		}
+	})
+	go func() {
+		a.watcher.WatchAll()
+		ScanAllFolders(a.db)
+		// Prune before the renderer starts writing new images
+		if n, err := a.db.PruneThumbnails(); err != nil {
+			fmt.Printf("warn: prune thumbnails: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("pruned %d unused thumbnails\n", n)
+		}
+		if a.db.GetSetting(settingThumbnailRenderer, ThumbnailsAuto) == ThumbnailsCPU {
+			a.thumbnails.Activate()
+		}
+		if p := a.GetPreviewSettings(); p.Enabled {
+			a.thumbnails.SetPreviewFrames(p.Frames)
+		}
+	}()
 }
 
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
+	if a.done != nil {
+		close(a.done)
+	}
+	if a.watcher != nil {
+		a.watcher.Close()
+	}
+	if a.thumbnails != nil {
+		a.thumbnails.Close()
+	}
 	if a.db != nil {
 		a.db.Close()
 	}
@@ -65,6 +102,14 @@ func (a *App) GetFileServerURL() string {
 	return fmt.Sprintf("http://127.0.0.1:%d", a.fileServer.Port)
 }
 
+// GetFileServerToken returns the per-session token required by the local file server.
+func (a *App) GetFileServerToken() string {
+	if a.fileServer == nil {
+		return ""
+	}
+	return a.fileServer.Token
+}
+
 // --- Watch Folder Methods ---
 
 // AddWatchFolder opens a folder picker, registers the folder, scans it, and returns the updated asset list.
@@ -90,16 +135,62 @@ func (a *App) AddWatchFolder() ([]Asset, error) {
 	} else {
 		fmt.Printf("scanned %s: found %d assets\n", dir, count)
 	}
+	a.watcher.Watch(*folder)
+	a.thumbnails.QueueMissing()
 
 	return a.GetAssets()
 }
 
 // RemoveWatchFolder removes a watch folder and all its assets from the DB.
 func (a *App) RemoveWatchFolder(id int64) error {
+	a.watcher.Unwatch(id)
 	if err := a.db.DeleteAssetsByFolder(id); err != nil {
 		return err
 	}
-	return a.db.RemoveWatchFolder(id)
+	if err := a.db.RemoveWatchFolder(id); err != nil {
+		return err
+	}
+	a.pruneJournal()
+	return nil
+}
+
+// RelocateWatchFolder points a watch folder at the folder's new location, such
+// as where its drive is now mounted, keeping its assets' tags, trays and
+// thumbnails. It asks for the location when path is empty, and rescans the
+// folder there to pick up anything that changed.
+func (a *App) RelocateWatchFolder(id int64, path string) ([]Asset, error) {
+	if path == "" {
+		dir, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "Select the folder's new location",
+		})
+		if err != nil {
+			return nil, err
+		}
+		if dir == "" {
+			return a.GetAssets()
+		}
+		path = dir
+	}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", path)
+	}
+
+	if err := a.db.RelocateWatchFolder(id, filepath.Clean(path)); err != nil {
+		return nil, fmt.Errorf("relocate folder: %w", err)
+	}
+	folder, err := a.db.GetWatchFolder(id)
+	if err != nil {
+		return nil, err
+	}
+	a.watcher.Unwatch(id)
+	if _, err := ScanFolder(a.db, *folder); err != nil {
+		fmt.Printf("scan error: %v\n", err)
+	}
+	a.watcher.Watch(*folder)
+	a.thumbnails.QueueMissing()
+	return a.GetAssets()
 }
 
 // GetWatchFolders returns all registered watch folders.
@@ -113,7 +204,10 @@ func (a *App) RescanFolder(id int64) ([]Asset, error) {
 	if err != nil {
 		return nil, err
 	}
-	ScanFolder(a.db, *folder)
+	if _, err := ScanFolder(a.db, *folder); err != nil {
+		return nil, err
+	}
+	a.thumbnails.QueueMissing()
 	return a.GetAssets()
 }
 
@@ -131,6 +225,60 @@ func (a *App) GetAssets() ([]Asset, error) {
 	return assets, nil
 }
 
+// QueryAssets runs a structured query such as "tag:prop -tag:wip poly<5000 ext:gltf".
+// sort is a frontend sort key ("name", "-file-size", ...) or empty for relevance;
+// a limit of zero returns every match. Parse errors describe the offending term.
+func (a *App) QueryAssets(q string, sort string, limit int, offset int) ([]Asset, error) {
+	assets, err := a.db.QueryAssets(q, sort, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if assets == nil {
+		assets = []Asset{}
+	}
+	return assets, nil
+}
+
+// FilterAssets returns every asset matching a filter, which combines tags, a
+// tray, a folder, flags and search text, sorted by sort (see QueryAssets).
+func (a *App) FilterAssets(filter AssetFilter, sort string) ([]Asset, error) {
+	assets, err := a.db.FilterAssets(filter, sort, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if assets == nil {
+		assets = []Asset{}
+	}
+	return assets, nil
+}
+
+// ListAssetsPage returns one page of the assets matching filter, sorted by sort
+// (see QueryAssets). Pass "" as the cursor for the first page and the returned
+// NextCursor for each one after; a limit of zero uses the default page size.
+func (a *App) ListAssetsPage(filter AssetFilter, sort string, cursor string, limit int) (*AssetPage, error) {
+	page, err := a.db.ListAssetsPage(filter, sort, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	if page.Assets == nil {
+		page.Assets = []Asset{}
+	}
+	return page, nil
+}
+
+// SearchAssets runs a full-text search over filenames, folders, tags, collections
+// and model node/material names, returning the best matches first.
+func (a *App) SearchAssets(query string) ([]Asset, error) {
+	assets, err := a.db.SearchAssets(query)
+	if err != nil {
+		return nil, err
+	}
+	if assets == nil {
+		assets = []Asset{}
+	}
+	return assets, nil
+}
+
 // GetAssetsByTag returns assets that have a specific tag.
 func (a *App) GetAssetsByTag(tagName string) ([]Asset, error) {
 	assets, err := a.db.GetAssetsByTag(tagName)
@@ -155,6 +303,19 @@ func (a *App) GetUntaggedAssets() ([]Asset, error) {
 	return assets, nil
 }
 
+// GetAssetsByTagSets returns one page of the assets that have all of include, any
+// of includeAny and none of exclude, sorted and paged as in ListAssetsPage.
+func (a *App) GetAssetsByTagSets(include []string, includeAny []string, exclude []string, sort string, cursor string, limit int) (*AssetPage, error) {
+	page, err := a.db.ListAssetsByTags(include, includeAny, exclude, sort, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	if page.Assets == nil {
+		page.Assets = []Asset{}
+	}
+	return page, nil
+}
+
 // GetAssetIDsByTags returns IDs of assets that have any of the given tags.
 func (a *App) GetAssetIDsByTags(tagNames []string) ([]int64, error) {
 	return a.db.GetAssetIDsByTags(tagNames)
@@ -174,49 +335,173 @@ func (a *App) GetFavoritedAssets() ([]Asset, error) {
 
 // ToggleFavorite toggles the favorite status of an asset.
 func (a *App) ToggleFavorite(assetID int64) (bool, error) {
-	return a.db.ToggleFavorite(assetID)
+	asset, err := a.db.GetAssetByID(assetID)
+	if err != nil {
+		return false, err
+	}
+	favorited := asset.Favorited == 0
+	return favorited, a.setFavorite([]int64{assetID}, favorited)
 }
 
 // BulkSetFavorite sets favorite status for multiple assets.
 func (a *App) BulkSetFavorite(assetIDs []int64, favorited bool) error {
-	return a.db.BulkSetFavorite(assetIDs, favorited)
+	return a.setFavorite(assetIDs, favorited)
 }
 
-// DeleteAsset deletes a single asset from disk and from the database.
+// DeleteAsset moves an asset's file to the trash. The asset keeps its tags and
+// trays, and RestoreAssets brings it back until the trash is emptied.
 func (a *App) DeleteAsset(assetID int64) error {
-	// Look up the asset path before deleting from DB
-	asset, err := a.db.GetAssetByID(assetID)
+	_, err := a.BulkDeleteAssets([]int64{assetID})
+	return err
+}
+
+// BulkDeleteAssets moves multiple assets to the trash. Returns the count moved.
+func (a *App) BulkDeleteAssets(assetIDs []int64) (int, error) {
+	var trashed []int64
+	var firstErr error
+	for _, id := range assetIDs {
+		if err := a.trashAsset(id); err != nil {
+			fmt.Printf("[trash] warn: %v\n", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		trashed = append(trashed, id)
+	}
+	if len(trashed) == 0 && firstErr != nil {
+		return 0, firstErr
+	}
+	if len(trashed) > 0 {
+		a.record(fmt.Sprintf("Move %s to the trash", countAssets(len(trashed))),
+			[]journalOp{{Kind: opTrash, AssetIDs: trashed}},
+			[]journalOp{{Kind: opRestore, AssetIDs: trashed}})
+	}
+	return len(trashed), nil
+}
+
+// trashAsset moves one asset's file into the trash. The row is marked trashed
+// first so the watcher keeps it when the file disappears.
+func (a *App) trashAsset(id int64) error {
+	asset, err := a.db.GetAssetByID(id)
 	if err != nil {
 		return fmt.Errorf("could not find asset: %w", err)
 	}
-	// Delete from database first
-	if err := a.db.DeleteAssetByID(assetID); err != nil {
+	if asset.TrashedAt != "" {
+		return nil
+	}
+	// Its file can't be moved while the folder is offline, and would only come
+	// back with the folder
+	if asset.Offline {
+		return fmt.Errorf("%s is in a folder that is offline", asset.Filename)
+	}
+	if err := a.db.TrashAsset(id, ""); err != nil {
 		return err
 	}
-	// Delete the file from disk (best-effort — don't fail if already gone)
-	os.Remove(asset.AbsolutePath)
-	return nil
+	// A file that is already gone leaves nothing to restore, but the row still
+	// goes to the trash so the delete is consistent.
+	trashPath, err := moveToTrash(asset.AbsolutePath)
+	if err != nil && !os.IsNotExist(err) {
+		a.db.RestoreAsset(id)
+		return fmt.Errorf("move %s to the trash: %w", asset.Filename, err)
+	}
+	return a.db.TrashAsset(id, trashPath)
 }
 
-// BulkDeleteAssets deletes multiple assets from disk and from the database. Returns the count removed.
-func (a *App) BulkDeleteAssets(assetIDs []int64) (int, error) {
-	// Collect paths before deleting from DB
-	var paths []string
+// RestoreAssets moves trashed assets back to where they were. Returns the count
+// restored.
+func (a *App) RestoreAssets(assetIDs []int64) (int, error) {
+	var restored []int64
+	var firstErr error
 	for _, id := range assetIDs {
-		asset, err := a.db.GetAssetByID(id)
-		if err == nil {
-			paths = append(paths, asset.AbsolutePath)
+		if err := a.restoreAsset(id); err != nil {
+			fmt.Printf("[trash] warn: %v\n", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
 		}
+		restored = append(restored, id)
+	}
+	if len(restored) == 0 && firstErr != nil {
+		return 0, firstErr
+	}
+	if len(restored) > 0 {
+		a.record(fmt.Sprintf("Restore %s from the trash", countAssets(len(restored))),
+			[]journalOp{{Kind: opRestore, AssetIDs: restored}},
+			[]journalOp{{Kind: opTrash, AssetIDs: restored}})
+	}
+	return len(restored), nil
+}
+
+func (a *App) restoreAsset(id int64) error {
+	asset, err := a.db.GetAssetByID(id)
+	if err != nil {
+		return fmt.Errorf("could not find asset: %w", err)
+	}
+	if asset.TrashedAt == "" {
+		return nil
+	}
+	trashPath, err := a.db.GetTrashPath(id)
+	if err != nil {
+		return err
+	}
+	if trashPath == "" {
+		return fmt.Errorf("restore %s: the file is no longer in the trash", asset.Filename)
+	}
+	if err := restoreFromTrash(trashPath, asset.AbsolutePath); err != nil {
+		return fmt.Errorf("restore %s: %w", asset.Filename, err)
 	}
-	count, err := a.db.DeleteAssetsByIDs(assetIDs)
+	return a.db.RestoreAsset(id)
+}
+
+// EmptyTrash permanently deletes every trashed asset and its file. Returns the
+// count deleted.
+func (a *App) EmptyTrash() (int, error) {
+	paths, err := a.db.PurgeTrash()
 	if err != nil {
 		return 0, err
 	}
-	// Delete files from disk (best-effort)
 	for _, p := range paths {
-		os.Remove(p)
+		if p != "" {
+			removeFromTrash(p)
+		}
 	}
-	return count, nil
+	a.pruneJournal()
+	return len(paths), nil
+}
+
+// FindDuplicates returns groups of assets whose files have identical contents.
+func (a *App) FindDuplicates() ([]DuplicateGroup, error) {
+	groups, err := a.db.FindDuplicates()
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []DuplicateGroup{}
+	}
+	return groups, nil
+}
+
+// ResolveDuplicates merges the tags, trays and favorite flag of the other copies
+// of a duplicated file into the one to keep. With trashOthers set, the other
+// copies are then moved to the trash; otherwise they stay where they are.
+func (a *App) ResolveDuplicates(keepID int64, duplicateIDs []int64, trashOthers bool) (*Asset, error) {
+	if err := a.db.MergeDuplicates(keepID, duplicateIDs); err != nil {
+		return nil, err
+	}
+	if trashOthers {
+		var others []int64
+		for _, id := range duplicateIDs {
+			if id != keepID {
+				others = append(others, id)
+			}
+		}
+		if _, err := a.BulkDeleteAssets(others); err != nil {
+			return nil, err
+		}
+	}
+	return a.db.GetAssetByID(keepID)
 }
 
 // MarkAssetUsed marks an asset as recently used.
@@ -276,11 +561,7 @@ func (a *App) GetTagsForAsset(assetID int64) ([]Tag, error) {
 
 // AddTagToAsset creates a tag if needed and attaches it to an asset.
 func (a *App) AddTagToAsset(assetID int64, tagName string) ([]Tag, error) {
-	tag, err := a.db.CreateTag(tagName)
-	if err != nil {
-		return nil, err
-	}
-	if err := a.db.TagAsset(assetID, tag.ID); err != nil {
+	if _, err := a.tagAssets([]int64{assetID}, tagName); err != nil {
 		return nil, err
 	}
 	return a.GetTagsForAsset(assetID)
@@ -288,18 +569,98 @@ func (a *App) AddTagToAsset(assetID int64, tagName string) ([]Tag, error) {
 
 // RemoveTagFromAsset removes a tag from an asset.
 func (a *App) RemoveTagFromAsset(assetID int64, tagID int64) ([]Tag, error) {
-	if err := a.db.UntagAsset(assetID, tagID); err != nil {
+	if err := a.untagAsset(assetID, tagID); err != nil {
 		return nil, err
 	}
 	return a.GetTagsForAsset(assetID)
 }
 
+// GetTagTree returns the tag hierarchy with counts rolled up from sub-tags.
+func (a *App) GetTagTree() ([]TagNode, error) {
+	return a.db.ListTagTree()
+}
+
+// RenameTag renames a tag; smart trays filtering on it follow the new name.
+func (a *App) RenameTag(id int64, name string) error {
+	return a.renameTag(id, name)
+}
+
+// MergeTags folds the source tags into the target, e.g. "chair" into "chairs":
+// their assets get the target tag and the sources are deleted.
+func (a *App) MergeTags(sourceIDs []int64, targetID int64) error {
+	if err := a.db.MergeTags(sourceIDs, targetID); err != nil {
+		return err
+	}
+	a.pruneJournal()
+	return nil
+}
+
+// DeleteTag removes a tag from every asset and deletes it.
+func (a *App) DeleteTag(id int64) error {
+	if err := a.db.DeleteTag(id); err != nil {
+		return err
+	}
+	a.pruneJournal()
+	return nil
+}
+
+// DeleteUnusedTags deletes tags that no asset has, returning how many.
+func (a *App) DeleteUnusedTags() (int, error) {
+	n, err := a.db.DeleteOrphanTags()
+	if err != nil {
+		return 0, err
+	}
+	a.pruneJournal()
+	return n, nil
+}
+
+// GetTagAliases returns every tag alias.
+func (a *App) GetTagAliases() ([]TagAlias, error) {
+	aliases, err := a.db.ListTagAliases()
+	if err != nil {
+		return nil, err
+	}
+	if aliases == nil {
+		aliases = []TagAlias{}
+	}
+	return aliases, nil
+}
+
+// AddTagAlias makes alias another name for a tag, merging any tag already
+// called that into it.
+func (a *App) AddTagAlias(alias string, tagID int64) error {
+	if err := a.db.AddTagAlias(alias, tagID); err != nil {
+		return err
+	}
+	a.pruneJournal()
+	return nil
+}
+
+// RemoveTagAlias deletes a tag alias.
+func (a *App) RemoveTagAlias(alias string) error {
+	return a.db.RemoveTagAlias(alias)
+}
+
+// --- Undo ---
+
+// Undo reverts the most recent library edit and returns its description, or ""
+// when there is nothing to undo.
+func (a *App) Undo() (string, error) {
+	return a.stepJournal(false)
+}
+
+// Redo reapplies the most recently undone edit and returns its description, or
+// "" when there is nothing to redo.
+func (a *App) Redo() (string, error) {
+	return a.stepJournal(true)
+}
+
 // --- Thumbnail Methods ---
 
-// SaveThumbnail saves a base64-encoded PNG thumbnail for an asset.
-// Called from the frontend after rendering with Three.js.
-func (a *App) SaveThumbnail(assetID int64, base64PNG string) error {
-	return a.db.SetThumbnail(assetID, base64PNG)
+// SaveThumbnail stores a thumbnail, given as a base64 image data URL, in the
+// thumbnail cache. Called from the frontend after rendering with Three.js.
+func (a *App) SaveThumbnail(assetID int64, dataURL string) error {
+	return a.db.SetThumbnail(assetID, dataURL)
 }
 
 // SavePolyCount saves the triangle/polygon count for an asset.
@@ -308,14 +669,187 @@ func (a *App) SavePolyCount(assetID int64, count int64) error {
 	return a.db.SetPolyCount(assetID, count)
 }
 
-// GetThumbnail returns the base64 PNG data for an asset's thumbnail.
+// GetThumbnail returns the file server URL of an asset's thumbnail, or "" if it has none.
 func (a *App) GetThumbnail(assetID int64) (string, error) {
 	return a.db.GetThumbnail(assetID)
 }
 
 // ClearAllThumbnails wipes all cached thumbnails so they regenerate on next load.
 func (a *App) ClearAllThumbnails() (int64, error) {
-	return a.db.ClearAllThumbnails()
+	a.thumbnails.RetryFailed()
+	n, err := a.db.ClearAllThumbnails()
+	if err != nil {
+		return 0, err
+	}
+	a.thumbnails.QueueMissing()
+	return n, nil
+}
+
+// GetThumbnailRenderer returns the thumbnail renderer preference: "auto" (WebGL in
+// the webview, CPU when that's unavailable) or "cpu" (always in the background).
+func (a *App) GetThumbnailRenderer() string {
+	return a.db.GetSetting(settingThumbnailRenderer, ThumbnailsAuto)
+}
+
+// SetThumbnailRenderer changes the thumbnail renderer preference.
+func (a *App) SetThumbnailRenderer(mode string) error {
+	if mode != ThumbnailsAuto && mode != ThumbnailsCPU {
+		return fmt.Errorf("unknown thumbnail renderer %q", mode)
+	}
+	if err := a.db.SetSetting(settingThumbnailRenderer, mode); err != nil {
+		return err
+	}
+	if mode == ThumbnailsCPU {
+		a.thumbnails.Activate()
+	} else {
+		a.thumbnails.Deactivate()
+	}
+	return nil
+}
+
+// GetPreviewSettings returns whether turntable and orthographic previews are
+// rendered, and how many turntable frames they have.
+func (a *App) GetPreviewSettings() PreviewSettings {
+	frames, err := strconv.Atoi(a.db.GetSetting(settingTurntableFrames, ""))
+	if err != nil || frames < minTurntableFrames || frames > maxTurntableFrames {
+		frames = defaultTurntableFrames
+	}
+	return PreviewSettings{
+		Enabled: a.db.GetSetting(settingPreviews, "off") == "on",
+		Frames:  frames,
+	}
+}
+
+// SetPreviewSettings turns previews on or off and sets the turntable length.
+// Turning them on renders previews for the whole library in the background; each
+// one is announced with a "previews:ready" event.
+func (a *App) SetPreviewSettings(settings PreviewSettings) error {
+	if settings.Frames < minTurntableFrames || settings.Frames > maxTurntableFrames {
+		return fmt.Errorf("turntable frames must be between %d and %d", minTurntableFrames, maxTurntableFrames)
+	}
+	enabled := "off"
+	if settings.Enabled {
+		enabled = "on"
+	}
+	if err := a.db.SetSetting(settingPreviews, enabled); err != nil {
+		return err
+	}
+	if err := a.db.SetSetting(settingTurntableFrames, strconv.Itoa(settings.Frames)); err != nil {
+		return err
+	}
+	if settings.Enabled {
+		a.thumbnails.SetPreviewFrames(settings.Frames)
+	} else {
+		a.thumbnails.SetPreviewFrames(0)
+	}
+	return nil
+}
+
+// GetAssetPreviews returns an asset's turntable and orthographic view strips,
+// which are empty if they haven't been rendered.
+func (a *App) GetAssetPreviews(assetID int64) (*AssetPreviews, error) {
+	return a.db.GetPreviews(assetID)
+}
+
+// RenderThumbnailsInBackground hands thumbnail rendering to the CPU renderer for
+// the rest of the session, e.g. because the webview has no WebGL. Each finished
+// thumbnail is announced with a "thumbnail:ready" event. Returns how many were queued.
+func (a *App) RenderThumbnailsInBackground() int {
+	return a.thumbnails.Activate()
+}
+
+// --- Backup Methods ---
+
+// backUpPeriodically takes a rolling backup whenever one is due, checking at
+// startup and then hourly until shutdown.
+func (a *App) backUpPeriodically() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if path, err := a.db.RollingBackup(time.Now()); err != nil {
+			fmt.Printf("[backup] warn: %v\n", err)
+		} else if path != "" {
+			fmt.Printf("[backup] backed up library to %s\n", path)
+		}
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// BackupLibrary writes a copy of the library database to path, asking where to
+// save it when path is empty. It returns the path written, or "" if cancelled.
+func (a *App) BackupLibrary(path string) (string, error) {
+	if path == "" {
+		var err error
+		path, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "Back up library",
+			DefaultFilename: "sushi-" + time.Now().Format("2006-01-02") + ".db",
+			Filters:         []runtime.FileFilter{{DisplayName: "SQLite database", Pattern: "*.db"}},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+	if err := a.db.Backup(path); err != nil {
+		return "", fmt.Errorf("back up library: %w", err)
+	}
+	return path, nil
+}
+
+// ExportLibrary writes the library's tags, trays, favorites and usage to a JSON
+// file at path, asking where to save it when path is empty. It returns the path
+// written, or "" if cancelled.
+func (a *App) ExportLibrary(path string) (string, error) {
+	if path == "" {
+		var err error
+		path, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "Export library",
+			DefaultFilename: "sushi-library.json",
+			Filters:         []runtime.FileFilter{{DisplayName: "JSON", Pattern: "*.json"}},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+	export, err := a.db.ExportLibrary()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ImportLibrary merges a library exported with ExportLibrary into this one,
+// asking for the file when path is empty. It returns nil if cancelled.
+func (a *App) ImportLibrary(path string) (*ImportSummary, error) {
+	if path == "" {
+		var err error
+		path, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:   "Import library",
+			Filters: []runtime.FileFilter{{DisplayName: "JSON", Pattern: "*.json"}},
+		})
+		if err != nil || path == "" {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export LibraryExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("%s is not a library export: %w", filepath.Base(path), err)
+	}
+	return a.db.ImportLibrary(&export)
 }
 
 // --- Utility Methods ---
@@ -333,7 +867,18 @@ func (a *App) CreateCollection(name string, icon string) (*Collection, error) {
 	return a.db.CreateCollection(name, icon)
 }
 
-// GetCollections returns all collections with their asset counts.
+// CreateSmartCollection makes a collection defined by a saved query such as
+// "tag:prop poly<2000 added:<30d". Its contents update as the library changes.
+func (a *App) CreateSmartCollection(name string, icon string, query string) (*Collection, error) {
+	return a.db.CreateSmartCollection(name, icon, query)
+}
+
+// UpdateSmartCollection replaces a smart collection's query.
+func (a *App) UpdateSmartCollection(id int64, query string) error {
+	return a.db.SetCollectionQuery(id, query)
+}
+
+// GetCollections returns all collections, manual and smart, with their asset counts.
 func (a *App) GetCollections() ([]Collection, error) {
 	cols, err := a.db.ListCollections()
 	if err != nil {
@@ -347,22 +892,26 @@ func (a *App) GetCollections() ([]Collection, error) {
 
 // RenameCollection renames a collection.
 func (a *App) RenameCollection(id int64, name string) error {
-	return a.db.RenameCollection(id, name)
+	return a.renameCollection(id, name)
 }
 
 // DeleteCollection removes a collection (assets are not deleted).
 func (a *App) DeleteCollection(id int64) error {
-	return a.db.DeleteCollection(id)
+	if err := a.db.DeleteCollection(id); err != nil {
+		return err
+	}
+	a.pruneJournal()
+	return nil
 }
 
 // AddToCollection adds an asset to a collection.
 func (a *App) AddToCollection(collectionID int64, assetID int64) error {
-	return a.db.AddAssetToCollection(collectionID, assetID)
+	return a.collectAssets(collectionID, []int64{assetID})
 }
 
 // RemoveFromCollection removes an asset from a collection.
 func (a *App) RemoveFromCollection(collectionID int64, assetID int64) error {
-	return a.db.RemoveAssetFromCollection(collectionID, assetID)
+	return a.uncollectAsset(collectionID, assetID)
 }
 
 // GetCollectionAssets returns all assets in a collection.
@@ -381,12 +930,13 @@ func (a *App) GetCollectionAssets(collectionID int64) ([]Asset, error) {
 
 // BulkTagAssets applies a tag to multiple assets at once.
 func (a *App) BulkTagAssets(assetIDs []int64, tagName string) error {
-	return a.db.BulkTagAssets(assetIDs, tagName)
+	_, err := a.tagAssets(assetIDs, tagName)
+	return err
 }
 
 // BulkAddToCollection adds multiple assets to a collection at once.
 func (a *App) BulkAddToCollection(collectionID int64, assetIDs []int64) error {
-	return a.db.BulkAddToCollection(collectionID, assetIDs)
+	return a.collectAssets(collectionID, assetIDs)
 }
 
 // GetTagsWithCounts returns all tags with usage counts, ordered by most common.
@@ -413,7 +963,7 @@ func (a *App) GetAssetsByTags(tagNames []string) ([]Asset, error) {
 	return assets, nil
 }
 
-// GetCollectionsForAsset returns which collections an asset belongs to.
+// GetCollectionsForAsset returns which manual collections an asset belongs to.
 func (a *App) GetCollectionsForAsset(assetID int64) ([]Collection, error) {
 	cols, err := a.db.GetCollectionsForAsset(assetID)
 	if err != nil {
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rolling backups are taken at most once per backupInterval and the newest
+// backupKeep are kept under backupDir.
+const (
+	backupInterval = 24 * time.Hour
+	backupKeep     = 7
+	backupLayout   = "20060102-150405"
+)
+
+// libraryExportVersion is the LibraryExport format written by ExportLibrary, and
+// the one ImportLibrary reads.
+const libraryExportVersion = 2
+
+// backupDir holds the rolling backups.
+func backupDir() string {
+	return filepath.Join(dataDir(), "backups")
+}
+
+// Backup writes a consistent copy of the database to path while it stays in
+// use, replacing any file already there.
+func (d *Database) Backup(path string) error {
+	// VACUUM INTO refuses to overwrite, and a failed backup shouldn't clobber
+	// a good one, so write beside the target and move it into place.
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := d.db.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// RollingBackup backs the database up into backupDir if backupInterval has
+// passed since the newest backup there, then deletes all but the newest
+// backupKeep. It returns the backup written, or "" when none was due.
+func (d *Database) RollingBackup(now time.Time) (string, error) {
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	backups, err := listBackups(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(backups) > 0 && now.Sub(backups[len(backups)-1].at) < backupInterval {
+		return "", nil
+	}
+
+	path := filepath.Join(dir, "sushi-"+now.UTC().Format(backupLayout)+".db")
+	if err := d.Backup(path); err != nil {
+		return "", err
+	}
+	backups = append(backups, backup{path, now})
+	for len(backups) > backupKeep {
+		if err := os.Remove(backups[0].path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[backup] warn: remove %s: %v\n", backups[0].path, err)
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+type backup struct {
+	path string
+	at   time.Time
+}
+
+// listBackups returns the rolling backups in dir, oldest first. Other files are
+// ignored, so copies the user made there are never pruned.
+func listBackups(dir string) ([]backup, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), "sushi-")
+		if !ok || e.IsDir() {
+			continue
+		}
+		at, err := time.Parse(backupLayout, strings.TrimSuffix(stamp, ".db"))
+		if err != nil || !strings.HasSuffix(stamp, ".db") {
+			continue
+		}
+		backups = append(backups, backup{filepath.Join(dir, e.Name()), at})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].at.Before(backups[j].at) })
+	return backups, nil
+}
+
+// --- Export & Import ---
+
+// LibraryExport is a portable copy of a library's curation: its tags, trays and
+// what has been done to each asset. Assets are identified by their path within
+// their watch folder and their content hash rather than by id or absolute path,
+// so an export can be applied to the same files on another machine.
+type LibraryExport struct {
+	Version     int                  `json:"version"`
+	ExportedAt  string               `json:"exported_at"`
+	Tags        []ExportedTag        `json:"tags"`
+	Collections []ExportedCollection `json:"collections"`
+	Assets      []ExportedAsset      `json:"assets"`
+}
+
+// ExportedTag is a tag path and its aliases.
+type ExportedTag struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// ExportedCollection is a tray. Members of manual trays are listed on the assets.
+type ExportedCollection struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon"`
+	Kind        string `json:"kind"`
+	Query       string `json:"query,omitempty"`
+}
+
+// ExportedAsset is the curation of one asset. Only assets with some are exported.
+type ExportedAsset struct {
+	// Folder is the name of the asset's watch folder, and Path is relative to
+	// it with forward slashes.
+	Folder      string   `json:"folder"`
+	Path        string   `json:"path"`
+	ContentHash string   `json:"content_hash"`
+	Favorited   bool     `json:"favorited,omitempty"`
+	LastUsedAt  string   `json:"last_used_at,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Collections []string `json:"collections,omitempty"`
+}
+
+// ImportSummary reports how an import went.
+type ImportSummary struct {
+	// Matched and Unmatched count the exported assets that were and weren't
+	// found in this library.
+	Matched   int `json:"matched"`
+	Unmatched int `json:"unmatched"`
+}
+
+// libraryFile is an asset as import and export identify it.
+type libraryFile struct {
+	id        int64
+	folder    string // the watch folder's name
+	path      string // relative to the watch folder, with forward slashes
+	hash      string
+	favorited bool
+	lastUsed  string
+}
+
+// libraryFiles returns every asset outside the trash, optionally only those
+// with some curation.
+func (d *Database) libraryFiles(curatedOnly bool) ([]libraryFile, error) {
+	query := `
+		SELECT a.id, w.path, a.relative_path, a.content_hash, a.favorited = 1, a.last_used_at
+		FROM assets a JOIN watch_folders w ON w.id = a.folder_id
+		WHERE a.trashed_at = '' AND a.relative_path != ''`
+	if curatedOnly {
+		query += ` AND (a.favorited = 1 OR a.last_used_at != ''
+			OR EXISTS (SELECT 1 FROM asset_tags at WHERE at.asset_id = a.id)
+			OR EXISTS (SELECT 1 FROM collection_assets ca WHERE ca.asset_id = a.id))`
+	}
+	rows, err := d.db.Query(query + " ORDER BY w.path, a.relative_path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []libraryFile
+	for rows.Next() {
+		var f libraryFile
+		var root string
+		if err := rows.Scan(&f.id, &root, &f.path, &f.hash, &f.favorited, &f.lastUsed); err != nil {
+			return nil, err
+		}
+		f.folder = filepath.Base(root)
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// namesByAsset runs a query of (asset id, name) pairs and groups the names.
+func (d *Database) namesByAsset(query string) (map[int64][]string, error) {
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = append(names[id], name)
+	}
+	return names, rows.Err()
+}
+
+// ExportLibrary gathers the library's curation for writing out as JSON.
+func (d *Database) ExportLibrary() (*LibraryExport, error) {
+	e := &LibraryExport{
+		Version:     libraryExportVersion,
+		ExportedAt:  time.Now().UTC().Format(time.RFC3339),
+		Tags:        []ExportedTag{},
+		Collections: []ExportedCollection{},
+		Assets:      []ExportedAsset{},
+	}
+
+	aliases, err := d.ListTagAliases()
+	if err != nil {
+		return nil, err
+	}
+	aliasesByTag := make(map[int64][]string)
+	for _, al := range aliases {
+		aliasesByTag[al.TagID] = append(aliasesByTag[al.TagID], al.Alias)
+	}
+	tags, err := d.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		e.Tags = append(e.Tags, ExportedTag{Name: t.Name, Aliases: aliasesByTag[t.ID]})
+	}
+
+	collections, err := d.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range collections {
+		e.Collections = append(e.Collections, ExportedCollection{
+			Name: c.Name, Description: c.Description, Icon: c.Icon, Kind: c.Kind, Query: c.Query,
+		})
+	}
+
+	tagsByAsset, err := d.namesByAsset(`
+		SELECT at.asset_id, t.name FROM asset_tags at JOIN tags t ON t.id = at.tag_id
+		ORDER BY t.name`)
+	if err != nil {
+		return nil, err
+	}
+	collectionsByAsset, err := d.namesByAsset(`
+		SELECT ca.asset_id, c.name FROM collection_assets ca JOIN collections c ON c.id = ca.collection_id
+		WHERE c.kind = '` + CollectionManual + `' ORDER BY c.name`)
+	if err != nil {
+		return nil, err
+	}
+	files, err := d.libraryFiles(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		e.Assets = append(e.Assets, ExportedAsset{
+			Folder:      f.folder,
+			Path:        f.path,
+			ContentHash: f.hash,
+			Favorited:   f.favorited,
+			LastUsedAt:  f.lastUsed,
+			Tags:        tagsByAsset[f.id],
+			Collections: collectionsByAsset[f.id],
+		})
+	}
+	return e, nil
+}
+
+// ImportLibrary merges an export into the library: missing tags, aliases and
+// trays are created, and each exported asset found here gains its tags, trays
+// and favorite. Nothing already in the library is removed or renamed.
+//
+// An exported asset matches the local assets with its content hash, narrowed to
+// the one at its path in a watch folder of the same name when there are copies
+// in several places. When no asset has its hash (say the file was re-saved
+// since), the asset at its path in a folder of that name matches.
+func (d *Database) ImportLibrary(e *LibraryExport) (*ImportSummary, error) {
+	if e.Version != libraryExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d (this version of sushi reads version %d)", e.Version, libraryExportVersion)
+	}
+	for _, c := range e.Collections {
+		if c.Kind == CollectionSmart {
+			if _, err := compileQuery(c.Query, nil); err != nil {
+				return nil, fmt.Errorf("tray %q: %w", c.Name, err)
+			}
+		}
+	}
+	files, err := d.libraryFiles(false)
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[string][]libraryFile)
+	byPath := make(map[string][]libraryFile)
+	for _, f := range files {
+		if f.hash != "" {
+			byHash[f.hash] = append(byHash[f.hash], f)
+		}
+		byPath[f.path] = append(byPath[f.path], f)
+	}
+	// at keeps the files at an exported asset's place: its path within a folder
+	// of its name.
+	at := func(files []libraryFile, ea ExportedAsset) []libraryFile {
+		var matched []libraryFile
+		for _, f := range files {
+			if f.path == ea.Path && f.folder == ea.Folder {
+				matched = append(matched, f)
+			}
+		}
+		return matched
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tagID := func(name string) (int64, error) {
+		name, err := resolveTagAlias(tx, normalizeTagName(name))
+		if err != nil || name == "" {
+			return 0, err
+		}
+		return ensureTag(tx, name)
+	}
+	for _, t := range e.Tags {
+		id, err := tagID(t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: %w", t.Name, err)
+		}
+		if id == 0 {
+			continue // a blank name has no tag to hang aliases on
+		}
+		for _, alias := range t.Aliases {
+			// An alias naming a tag here would mean merging the two, which an
+			// import shouldn't do behind the user's back.
+			alias = normalizeTagName(alias)
+			if alias == "" {
+				continue
+			}
+			if _, err := tx.Exec(`
+				INSERT OR IGNORE INTO tag_aliases (alias, tag_id)
+				SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM tags WHERE name = ? COLLATE NOCASE)
+			`, alias, id, alias); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	trays := make(map[string]int64)
+	for _, c := range e.Collections {
+		var id int64
+		var kind string
+		err := tx.QueryRow("SELECT id, kind FROM collections WHERE name = ?", c.Name).Scan(&id, &kind)
+		if errors.Is(err, sql.ErrNoRows) {
+			kind = c.Kind
+			if kind != CollectionSmart {
+				kind = CollectionManual
+			}
+			icon := c.Icon
+			if icon == "" {
+				icon = "📁"
+			}
+			var res sql.Result
+			res, err = tx.Exec("INSERT INTO collections (name, description, icon, kind, query) VALUES (?, ?, ?, ?, ?)",
+				c.Name, c.Description, icon, kind, c.Query)
+			if err == nil {
+				id, _ = res.LastInsertId()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tray %q: %w", c.Name, err)
+		}
+		if kind == CollectionManual {
+			trays[c.Name] = id
+		}
+	}
+
+	summary := &ImportSummary{}
+	for _, ea := range e.Assets {
+		matches := byHash[ea.ContentHash]
+		if ea.ContentHash == "" {
+			matches = nil
+		}
+		if len(matches) > 1 {
+			if placed := at(matches, ea); len(placed) > 0 {
+				matches = placed[:1]
+			}
+		}
+		if len(matches) == 0 {
+			matches = at(byPath[ea.Path], ea)
+		}
+		if len(matches) == 0 {
+			summary.Unmatched++
+			continue
+		}
+		summary.Matched++
+
+		for _, f := range matches {
+			if ea.Favorited {
+				if _, err := tx.Exec("UPDATE assets SET favorited = 1 WHERE id = ?", f.id); err != nil {
+					return nil, err
+				}
+			}
+			if ea.LastUsedAt != "" {
+				if _, err := tx.Exec("UPDATE assets SET last_used_at = MAX(last_used_at, ?) WHERE id = ?", ea.LastUsedAt, f.id); err != nil {
+					return nil, err
+				}
+			}
+			for _, name := range ea.Tags {
+				id, err := tagID(name)
+				if err != nil {
+					return nil, fmt.Errorf("tag %q: %w", name, err)
+				}
+				if id == 0 {
+					continue
+				}
+				if _, err := tx.Exec("INSERT OR IGNORE INTO asset_tags (asset_id, tag_id) VALUES (?, ?)", f.id, id); err != nil {
+					return nil, err
+				}
+			}
+			for _, name := range ea.Collections {
+				if id, ok := trays[name]; ok {
+					if _, err := tx.Exec("INSERT OR IGNORE INTO collection_assets (collection_id, asset_id) VALUES (?, ?)", id, f.id); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return summary, tx.Commit()
+}
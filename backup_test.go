@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportLibraryBlankTag(t *testing.T) {
+	d := newTestDatabase(t)
+	e := &LibraryExport{
+		Version: libraryExportVersion,
+		Tags: []ExportedTag{
+			{Name: " / ", Aliases: []string{"nothing"}},
+			{Name: "props/crate", Aliases: []string{"box"}},
+		},
+	}
+	if _, err := d.ImportLibrary(e); err != nil {
+		t.Fatalf("ImportLibrary: %v", err)
+	}
+
+	tags, err := d.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if got, want := strings.Join(names, ","), "props,props/crate"; got != want {
+		t.Errorf("tags = %s, want %s", got, want)
+	}
+	aliases, err := d.ListTagAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || aliases[0].Alias != "box" || aliases[0].TagName != "props/crate" {
+		t.Errorf("aliases = %+v, want only box for props/crate", aliases)
+	}
+}
+
+func TestImportLibraryVersion(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, v := range []int{0, 1, libraryExportVersion + 1} {
+		if _, err := d.ImportLibrary(&LibraryExport{Version: v}); err == nil {
+			t.Errorf("ImportLibrary accepted version %d", v)
+		}
+	}
+	if _, err := d.ImportLibrary(&LibraryExport{Version: libraryExportVersion}); err != nil {
+		t.Errorf("ImportLibrary version %d: %v", libraryExportVersion, err)
+	}
+}
@@ -14,7 +14,7 @@ import requests from Sushi. All communication is local-only.
 bl_info = {
     "name": "Sushi Bridge",
     "author": "sushi",
-    "version": (0, 1, 0),
+    "version": (0, 2, 0),
     "blender": (3, 0, 0),
     "location": "Runs in background",
     "description": "Receives 3D assets from the Sushi asset manager",
@@ -69,17 +69,18 @@ class SushiHandler(BaseHTTPRequestHandler):
             return
 
         action = data.get("action")
-        files = data.get("files", [])
+        # Newer Sushi builds send {"path", "format"} items; older ones only paths
+        items = data.get("items") or [{"path": p} for p in data.get("files", [])]
 
-        if action == "import" and files:
+        if action == "import" and items:
             # Schedule the import on Blender's main thread via a timer
-            bpy.app.timers.register(partial(_import_files, files))
+            bpy.app.timers.register(partial(_import_files, items))
             self.send_response(200)
             self.send_header("Content-Type", "application/json")
             self.end_headers()
             self.wfile.write(json.dumps({
                 "status": "ok",
-                "queued": len(files),
+                "queued": len(items),
             }).encode())
         else:
             self.send_response(400)
@@ -90,21 +91,72 @@ class SushiHandler(BaseHTTPRequestHandler):
 
 # ── Import Logic ──────────────────────────────────────────────────────
 
-def _import_files(file_paths):
+def _has_op(module, name):
+    """True if bpy.ops.<module>.<name> exists in this Blender version."""
+    return hasattr(getattr(bpy.ops, module), name)
+
+
+def _import_obj(path):
+    # Blender 4.0 removed the legacy Python OBJ importer in favour of wm.obj_import
+    if _has_op("wm", "obj_import"):
+        bpy.ops.wm.obj_import(filepath=path)
+    else:
+        bpy.ops.import_scene.obj(filepath=path)
+
+
+def _import_stl(path):
+    if _has_op("wm", "stl_import"):
+        bpy.ops.wm.stl_import(filepath=path)
+    else:
+        bpy.ops.import_mesh.stl(filepath=path)
+
+
+def _import_ply(path):
+    if _has_op("wm", "ply_import"):
+        bpy.ops.wm.ply_import(filepath=path)
+    else:
+        bpy.ops.import_mesh.ply(filepath=path)
+
+
+def _import_blend(path):
+    """Append every object from another .blend file and link it into the scene."""
+    with bpy.data.libraries.load(path, link=False) as (data_from, data_to):
+        data_to.objects = list(data_from.objects)
+    for obj in data_to.objects:
+        if obj is not None:
+            bpy.context.collection.objects.link(obj)
+
+
+IMPORTERS = {
+    "glb": lambda p: bpy.ops.import_scene.gltf(filepath=p),
+    "gltf": lambda p: bpy.ops.import_scene.gltf(filepath=p),
+    "obj": _import_obj,
+    "fbx": lambda p: bpy.ops.import_scene.fbx(filepath=p),
+    "stl": _import_stl,
+    "ply": _import_ply,
+    "dae": lambda p: bpy.ops.wm.collada_import(filepath=p),
+    "usdz": lambda p: bpy.ops.wm.usd_import(filepath=p),
+    "blend": _import_blend,
+}
+
+
+def _import_files(items):
     """Called on Blender's main thread to import the given files."""
-    for path in file_paths:
-        path = os.path.abspath(path)
+    for item in items:
+        path = os.path.abspath(item["path"])
         if not os.path.isfile(path):
             print(f"[sushi] file not found: {path}")
             continue
 
-        ext = os.path.splitext(path)[1].lower()
+        # Fall back to the extension for requests that don't name a format
+        fmt = item.get("format") or os.path.splitext(path)[1].lower().lstrip(".")
+        importer = IMPORTERS.get(fmt)
         try:
-            if ext == ".glb" or ext == ".gltf":
-                bpy.ops.import_scene.gltf(filepath=path)
+            if importer is not None:
+                importer(path)
                 print(f"[sushi] imported: {path}")
             else:
-                print(f"[sushi] unsupported format: {ext}")
+                print(f"[sushi] unsupported format: {fmt}")
         except Exception as e:
             print(f"[sushi] import error for {path}: {e}")
 
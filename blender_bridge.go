@@ -13,8 +13,15 @@ const blenderAddonPort = 29877
 
 // BlenderSendRequest is the payload sent to the Blender addon.
 type BlenderSendRequest struct {
-	Action string   `json:"action"` // "import"
-	Files  []string `json:"files"`  // absolute paths
+	Action string              `json:"action"` // "import"
+	Files  []string            `json:"files"`  // absolute paths, kept for older addons
+	Items  []BlenderImportItem `json:"items"`
+}
+
+// BlenderImportItem tells the addon which importer to use for a file.
+type BlenderImportItem struct {
+	Path   string `json:"path"`
+	Format string `json:"format"` // ModelFormat.Name, e.g. "gltf", "obj", "blend"
 }
 
 // BlenderStatus represents the connection status with the Blender addon.
@@ -29,6 +36,13 @@ func (a *App) SendToBlender(absolutePaths []string) BlenderStatus {
 		Action: "import",
 		Files:  absolutePaths,
 	}
+	for _, p := range absolutePaths {
+		item := BlenderImportItem{Path: p}
+		if f := formatForPath(p); f != nil {
+			item.Format = f.Name
+		}
+		payload.Items = append(payload.Items, item)
+	}
 	body, _ := json.Marshal(payload)
 
 	client := &http.Client{Timeout: 3 * time.Second}
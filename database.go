@@ -2,9 +2,11 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -15,22 +17,41 @@ type WatchFolder struct {
 	ID        int64  `json:"id"`
 	Path      string `json:"path"`
 	CreatedAt string `json:"created_at"`
+	// OfflineSince is when the folder's root stopped being reachable (an
+	// unmounted drive, say), or "" while it is reachable.
+	OfflineSince string `json:"offline_since"`
 }
 
-// Asset represents a single .glb/.gltf file found on disk.
+// Asset represents a single model file found on disk.
 type Asset struct {
-	ID           int64  `json:"id"`
-	AbsolutePath string `json:"absolute_path"`
-	Filename     string `json:"filename"`
-	FolderID     int64  `json:"folder_id"`
-	FileSize     int64  `json:"file_size"`
-	ModifiedAt   string `json:"modified_at"`
-	Thumbnail    string `json:"thumbnail"`
-	Favorited    int64  `json:"favorited"`
-	LastUsedAt   string `json:"last_used_at"`
-	PolyCount    int64  `json:"poly_count"`
-	CreatedAt    string `json:"created_at"`
-	UpdatedAt    string `json:"updated_at"`
+	ID             int64   `json:"id"`
+	AbsolutePath   string  `json:"absolute_path"`
+	RelativePath   string  `json:"relative_path"` // within the watch folder, with forward slashes
+	Filename       string  `json:"filename"`
+	FolderID       int64   `json:"folder_id"`
+	FileSize       int64   `json:"file_size"`
+	ModifiedAt     string  `json:"modified_at"`
+	Thumbnail      string  `json:"thumbnail"` // URL on the local file server, or ""
+	Favorited      int64   `json:"favorited"`
+	LastUsedAt     string  `json:"last_used_at"`
+	PolyCount      int64   `json:"poly_count"`
+	VertexCount    int64   `json:"vertex_count"`
+	MeshCount      int64   `json:"mesh_count"`
+	MaterialCount  int64   `json:"material_count"`
+	TextureCount   int64   `json:"texture_count"`
+	AnimationCount int64   `json:"animation_count"`
+	SkinCount      int64   `json:"skin_count"`
+	NodeCount      int64   `json:"node_count"`
+	BoundsX        float64 `json:"bounds_x"`
+	BoundsY        float64 `json:"bounds_y"`
+	BoundsZ        float64 `json:"bounds_z"`
+	Generator      string  `json:"generator"`
+	Copyright      string  `json:"copyright"`
+	ExtensionsUsed string  `json:"extensions_used"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+	TrashedAt      string  `json:"trashed_at"` // "" unless the asset is in the trash
+	Offline        bool    `json:"offline"`    // its watch folder can't be reached
 }
 
 // Tag represents a user-defined label.
@@ -41,17 +62,27 @@ type Tag struct {
 
 // Database wraps the SQLite connection and provides all data methods.
 type Database struct {
-	db *sql.DB
+	db     *sql.DB
+	path   string
+	thumbs *ThumbnailCache
+	// thumbBaseURL is prepended to thumbnail cache keys to give Asset.Thumbnail;
+	// it is set once the local file server is up.
+	thumbBaseURL string
 }
 
-// NewDatabase opens (or creates) the SQLite database and runs the schema.
-func NewDatabase() (*Database, error) {
+// dataDir returns the directory holding the database and thumbnail cache.
+func dataDir() string {
 	dataHome := os.Getenv("XDG_DATA_HOME")
 	if dataHome == "" {
 		home, _ := os.UserHomeDir()
 		dataHome = filepath.Join(home, ".local", "share")
 	}
-	dbDir := filepath.Join(dataHome, "sushi")
+	return filepath.Join(dataHome, "sushi")
+}
+
+// NewDatabase opens (or creates) the SQLite database and runs the schema.
+func NewDatabase() (*Database, error) {
+	dbDir := dataDir()
 	os.MkdirAll(dbDir, 0755)
 	dbPath := filepath.Join(dbDir, "sushi.db")
 
@@ -62,84 +93,27 @@ func NewDatabase() (*Database, error) {
 	// SQLite only supports one writer — limit pool to avoid SQLITE_BUSY errors
 	db.SetMaxOpenConns(1)
 
-	d := &Database{db: db}
+	d := &Database{db: db, path: dbPath, thumbs: NewThumbnailCache(filepath.Join(dbDir, "thumbnails"))}
 	if err := d.migrate(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
 	return d, nil
 }
 
-func (d *Database) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS watch_folders (
-		id         INTEGER PRIMARY KEY AUTOINCREMENT,
-		path       TEXT    NOT NULL UNIQUE,
-		created_at TEXT    NOT NULL DEFAULT (datetime('now'))
-	);
-
-	CREATE TABLE IF NOT EXISTS assets (
-		id            INTEGER PRIMARY KEY AUTOINCREMENT,
-		absolute_path TEXT    NOT NULL UNIQUE,
-		filename      TEXT    NOT NULL,
-		folder_id     INTEGER NOT NULL REFERENCES watch_folders(id) ON DELETE CASCADE,
-		file_size     INTEGER NOT NULL,
-		modified_at   TEXT    NOT NULL,
-		thumbnail     TEXT    DEFAULT '',
-		favorited     INTEGER NOT NULL DEFAULT 0,
-		last_used_at  TEXT    DEFAULT '',
-		poly_count    INTEGER NOT NULL DEFAULT 0,
-		created_at    TEXT    NOT NULL DEFAULT (datetime('now')),
-		updated_at    TEXT    NOT NULL DEFAULT (datetime('now'))
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_assets_folder   ON assets(folder_id);
-	CREATE INDEX IF NOT EXISTS idx_assets_filename  ON assets(filename);
-
-	CREATE TABLE IF NOT EXISTS tags (
-		id   INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT    NOT NULL UNIQUE
-	);
-
-	CREATE TABLE IF NOT EXISTS asset_tags (
-		asset_id INTEGER NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
-		tag_id   INTEGER NOT NULL REFERENCES tags(id)   ON DELETE CASCADE,
-		PRIMARY KEY (asset_id, tag_id)
-	);
-
-	CREATE TABLE IF NOT EXISTS collections (
-		id          INTEGER PRIMARY KEY AUTOINCREMENT,
-		name        TEXT    NOT NULL UNIQUE,
-		description TEXT    NOT NULL DEFAULT '',
-		icon        TEXT    NOT NULL DEFAULT '📁',
-		created_at  TEXT    NOT NULL DEFAULT (datetime('now'))
-	);
-
-	CREATE TABLE IF NOT EXISTS collection_assets (
-		collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
-		asset_id      INTEGER NOT NULL REFERENCES assets(id)      ON DELETE CASCADE,
-		added_at      TEXT    NOT NULL DEFAULT (datetime('now')),
-		PRIMARY KEY (collection_id, asset_id)
-	);
-	`
-	_, err := d.db.Exec(schema)
-	if err != nil {
-		return err
-	}
-
-	// Add columns if they don't exist (for existing databases)
-	d.db.Exec("ALTER TABLE assets ADD COLUMN favorited INTEGER NOT NULL DEFAULT 0")
-	d.db.Exec("ALTER TABLE assets ADD COLUMN last_used_at TEXT DEFAULT ''")
-	d.db.Exec("ALTER TABLE assets ADD COLUMN poly_count INTEGER NOT NULL DEFAULT 0")
-
-	return nil
-}
-
-// ClearAllThumbnails resets thumbnail and poly_count for all assets so they regenerate.
+// ClearAllThumbnails resets the thumbnail and previews for all assets so they
+// regenerate, and empties the thumbnail cache. poly_count is left alone because
+// the scanner reads it from the file.
 func (d *Database) ClearAllThumbnails() (int64, error) {
-	res, err := d.db.Exec("UPDATE assets SET thumbnail = '', poly_count = 0")
+	start := time.Now()
+	res, err := d.db.Exec("UPDATE assets SET thumbnail = ''")
 	if err != nil {
 		return 0, err
 	}
+	if _, err := d.db.Exec("DELETE FROM asset_previews"); err != nil {
+		return 0, err
+	}
+	d.thumbs.Prune(nil, start)
 	n, _ := res.RowsAffected()
 	return n, nil
 }
@@ -156,9 +130,9 @@ func (d *Database) AddWatchFolder(path string) (*WatchFolder, error) {
 }
 
 func (d *Database) GetWatchFolder(id int64) (*WatchFolder, error) {
-	row := d.db.QueryRow("SELECT id, path, created_at FROM watch_folders WHERE id = ?", id)
+	row := d.db.QueryRow("SELECT id, path, created_at, offline_since FROM watch_folders WHERE id = ?", id)
 	f := &WatchFolder{}
-	err := row.Scan(&f.ID, &f.Path, &f.CreatedAt)
+	err := row.Scan(&f.ID, &f.Path, &f.CreatedAt, &f.OfflineSince)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +140,7 @@ func (d *Database) GetWatchFolder(id int64) (*WatchFolder, error) {
 }
 
 func (d *Database) ListWatchFolders() ([]WatchFolder, error) {
-	rows, err := d.db.Query("SELECT id, path, created_at FROM watch_folders ORDER BY path")
+	rows, err := d.db.Query("SELECT id, path, created_at, offline_since FROM watch_folders ORDER BY path")
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +149,7 @@ func (d *Database) ListWatchFolders() ([]WatchFolder, error) {
 	var folders []WatchFolder
 	for rows.Next() {
 		var f WatchFolder
-		if err := rows.Scan(&f.ID, &f.Path, &f.CreatedAt); err != nil {
+		if err := rows.Scan(&f.ID, &f.Path, &f.CreatedAt, &f.OfflineSince); err != nil {
 			return nil, err
 		}
 		folders = append(folders, f)
@@ -190,92 +164,175 @@ func (d *Database) RemoveWatchFolder(id int64) error {
 
 // --- Assets ---
 
-func (d *Database) UpsertAsset(absolutePath string, folderID int64, fileSize int64, modifiedAt time.Time) (*Asset, error) {
+// assetColumns selects every Asset field from assets aliased as a, in the order
+// scanAsset reads them.
+const assetColumns = `a.id, a.absolute_path, a.relative_path, a.filename, a.folder_id, a.file_size, a.modified_at, a.thumbnail, a.favorited, a.last_used_at, a.poly_count, a.vertex_count, a.mesh_count, a.material_count, a.texture_count, a.animation_count, a.skin_count, a.node_count, a.bounds_x, a.bounds_y, a.bounds_z, a.generator, a.copyright, a.extensions_used, a.created_at, a.updated_at, a.trashed_at, ` + offlineSQL
+
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAsset reads a row that starts with assetColumns, storing any columns after
+// them in extra.
+func (d *Database) scanAsset(row rowScanner, extra ...interface{}) (Asset, error) {
+	var a Asset
+	dest := []interface{}{&a.ID, &a.AbsolutePath, &a.RelativePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.VertexCount, &a.MeshCount, &a.MaterialCount, &a.TextureCount, &a.AnimationCount, &a.SkinCount, &a.NodeCount, &a.BoundsX, &a.BoundsY, &a.BoundsZ, &a.Generator, &a.Copyright, &a.ExtensionsUsed, &a.CreatedAt, &a.UpdatedAt, &a.TrashedAt, &a.Offline}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return Asset{}, err
+	}
+	a.Thumbnail = d.thumbnailURL(a.Thumbnail)
+	return a, nil
+}
+
+// queryAssets runs a query that selects assetColumns and returns every row.
+func (d *Database) queryAssets(query string, args ...interface{}) ([]Asset, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []Asset
+	for rows.Next() {
+		a, err := d.scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
+
+// getAsset returns the one asset matching a condition on assets aliased as a.
+func (d *Database) getAsset(where string, args ...interface{}) (*Asset, error) {
+	a, err := d.scanAsset(d.db.QueryRow("SELECT "+assetColumns+" FROM assets a WHERE "+where, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (d *Database) UpsertAsset(absolutePath string, folder WatchFolder, fileSize int64, modifiedAt time.Time, inode, device int64) (*Asset, error) {
 	filename := filepath.Base(absolutePath)
 	modStr := modifiedAt.UTC().Format(time.RFC3339)
 	nowStr := time.Now().UTC().Format(time.RFC3339)
 
 	_, err := d.db.Exec(`
-		INSERT INTO assets (absolute_path, filename, folder_id, file_size, modified_at, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO assets (absolute_path, relative_path, filename, folder_id, file_size, modified_at, inode, device, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(absolute_path) DO UPDATE SET
-			file_size   = excluded.file_size,
-			modified_at = excluded.modified_at,
-			updated_at  = ?
-	`, absolutePath, filename, folderID, fileSize, modStr, nowStr, nowStr, nowStr)
+			relative_path = excluded.relative_path,
+			folder_id     = excluded.folder_id,
+			file_size     = excluded.file_size,
+			modified_at   = excluded.modified_at,
+			inode         = excluded.inode,
+			device        = excluded.device,
+			updated_at    = ?
+	`, absolutePath, relativePath(folder.Path, absolutePath), filename, folder.ID, fileSize, modStr, inode, device, nowStr, nowStr, nowStr)
 	if err != nil {
 		return nil, err
 	}
 
-	row := d.db.QueryRow("SELECT id, absolute_path, filename, folder_id, file_size, modified_at, thumbnail, favorited, last_used_at, poly_count, created_at, updated_at FROM assets WHERE absolute_path = ?", absolutePath)
-	a := &Asset{}
-	err = row.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt)
-	return a, err
+	return d.GetAssetByPath(absolutePath)
 }
 
-func (d *Database) ListAssets() ([]Asset, error) {
-	rows, err := d.db.Query("SELECT id, absolute_path, filename, folder_id, file_size, modified_at, thumbnail, favorited, last_used_at, poly_count, created_at, updated_at FROM assets ORDER BY filename")
+func (d *Database) GetAssetByPath(absolutePath string) (*Asset, error) {
+	return d.getAsset("a.absolute_path = ?", absolutePath)
+}
+
+// FindMovedAsset looks for an existing asset whose recorded path no longer exists
+// on disk but which matches the given file by inode, device and size, or by content hash —
+// i.e. the same file under a new name. Assets in offline folders are only
+// unreachable, not moved, so they are never matched. Returns nil if there is no
+// such asset.
+func (d *Database) FindMovedAsset(inode, device int64, fileSize int64, contentHash string) (*Asset, error) {
+	if inode == 0 && contentHash == "" {
+		return nil, nil
+	}
+	rows, err := d.db.Query(`
+		SELECT a.id, a.absolute_path FROM assets a
+		WHERE a.trashed_at = '' AND NOT `+offlineSQL+`
+		  AND ((a.inode != 0 AND a.inode = ? AND a.device IN (0, ?) AND a.file_size = ?)
+		   OR (a.content_hash != '' AND a.content_hash = ?))
+	`, inode, device, fileSize, contentHash)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var assets []Asset
+	type candidate struct {
+		id   int64
+		path string
+	}
+	var candidates []candidate
 	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.path); err != nil {
 			return nil, err
 		}
-		assets = append(assets, a)
+		candidates = append(candidates, c)
 	}
-	return assets, nil
+	rows.Close()
+
+	for _, c := range candidates {
+		if _, err := os.Stat(c.path); os.IsNotExist(err) {
+			return d.GetAssetByID(c.id)
+		}
+	}
+	return nil, nil
 }
 
-func (d *Database) DeleteAssetByPath(absolutePath string) error {
-	_, err := d.db.Exec("DELETE FROM assets WHERE absolute_path = ?", absolutePath)
+// RelocateAsset re-points an existing asset row at a new path, keeping its tags,
+// collections, favorite flag and thumbnail.
+func (d *Database) RelocateAsset(id int64, absolutePath string, folder WatchFolder) error {
+	nowStr := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.db.Exec(`
+		UPDATE assets SET absolute_path = ?, relative_path = ?, filename = ?, folder_id = ?, updated_at = ?
+		WHERE id = ?
+	`, absolutePath, relativePath(folder.Path, absolutePath), filepath.Base(absolutePath), folder.ID, nowStr, id)
 	return err
 }
 
-func (d *Database) GetAssetByID(id int64) (*Asset, error) {
-	row := d.db.QueryRow(`
-		SELECT id, absolute_path, filename, folder_id, file_size, modified_at,
-		       thumbnail, favorited, last_used_at, poly_count, created_at, updated_at
-		FROM assets WHERE id = ?
-	`, id)
-	a := &Asset{}
-	err := row.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize,
-		&a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount,
-		&a.CreatedAt, &a.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return a, nil
+func (d *Database) ListAssets() ([]Asset, error) {
+	return d.FilterAssets(AssetFilter{}, "name", 0, 0)
 }
 
-func (d *Database) DeleteAssetByID(id int64) error {
-	_, err := d.db.Exec("DELETE FROM assets WHERE id = ?", id)
+func (d *Database) DeleteAssetByPath(absolutePath string) error {
+	_, err := d.db.Exec("DELETE FROM assets WHERE absolute_path = ? AND trashed_at = ''", absolutePath)
 	return err
 }
 
-func (d *Database) DeleteAssetsByIDs(ids []int64) (int, error) {
-	if len(ids) == 0 {
-		return 0, nil
-	}
-	tx, err := d.db.Begin()
+// DeleteAssetsUnderDir removes every asset stored beneath a directory and
+// returns the paths that were removed. Trashed assets are kept.
+func (d *Database) DeleteAssetsUnderDir(dir string) ([]string, error) {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	rows, err := d.db.Query("SELECT absolute_path FROM assets WHERE substr(absolute_path, 1, length(?)) = ? AND trashed_at = ''", prefix, prefix)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	count := 0
-	for _, id := range ids {
-		res, err := tx.Exec("DELETE FROM assets WHERE id = ?", id)
-		if err != nil {
-			tx.Rollback()
-			return 0, err
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
 		}
-		affected, _ := res.RowsAffected()
-		count += int(affected)
+		paths = append(paths, p)
 	}
-	return count, tx.Commit()
+	rows.Close()
+
+	for _, p := range paths {
+		if err := d.DeleteAssetByPath(p); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+func (d *Database) GetAssetByID(id int64) (*Asset, error) {
+	return d.getAsset("a.id = ?", id)
 }
 
 func (d *Database) DeleteAssetsByFolder(folderID int64) error {
@@ -284,8 +341,11 @@ func (d *Database) DeleteAssetsByFolder(folderID int64) error {
 }
 
 // PruneAssetsForFolder removes DB rows for files that no longer exist on disk.
-func (d *Database) PruneAssetsForFolder(folderID int64) (int, error) {
-	rows, err := d.db.Query("SELECT id, absolute_path FROM assets WHERE folder_id = ?", folderID)
+// Trashed assets are expected to be missing and are kept. Files only count as
+// missing if the folder is still reachable once they've been checked, so a
+// drive going away mid-scan doesn't take its assets with it.
+func (d *Database) PruneAssetsForFolder(folder WatchFolder) (int, error) {
+	rows, err := d.db.Query("SELECT id, absolute_path FROM assets WHERE folder_id = ? AND trashed_at = ''", folder.ID)
 	if err != nil {
 		return 0, err
 	}
@@ -302,69 +362,139 @@ func (d *Database) PruneAssetsForFolder(folderID int64) (int, error) {
 			toDelete = append(toDelete, id)
 		}
 	}
+	rows.Close()
 
+	if len(toDelete) > 0 && !d.FolderReachable(folder) {
+		return 0, fmt.Errorf("%s: %w", folder.Path, errFolderOffline)
+	}
 	for _, id := range toDelete {
 		d.db.Exec("DELETE FROM assets WHERE id = ?", id)
 	}
 	return len(toDelete), nil
 }
 
-// --- Untagged / Favorites / Recently Used ---
+// --- Content Hashes & Duplicates ---
 
-func (d *Database) GetUntaggedAssets() ([]Asset, error) {
+func (d *Database) GetContentHash(assetID int64) (string, error) {
+	var hash string
+	err := d.db.QueryRow("SELECT content_hash FROM assets WHERE id = ?", assetID).Scan(&hash)
+	return hash, err
+}
+
+// GetMetadataVersion returns the extractor version that last populated an asset's model metadata.
+func (d *Database) GetMetadataVersion(assetID int64) (int, error) {
+	var v int
+	err := d.db.QueryRow("SELECT metadata_version FROM assets WHERE id = ?", assetID).Scan(&v)
+	return v, err
+}
+
+// SetMetadataVersion records that an extractor version has seen an asset's file
+// without storing anything from it, e.g. because the file couldn't be parsed.
+func (d *Database) SetMetadataVersion(assetID int64, version int) error {
+	_, err := d.db.Exec("UPDATE assets SET metadata_version = ? WHERE id = ?", version, assetID)
+	return err
+}
+
+func (d *Database) SetContentHash(assetID int64, hash string) error {
+	_, err := d.db.Exec("UPDATE assets SET content_hash = ? WHERE id = ?", hash, assetID)
+	return err
+}
+
+// DuplicateGroup is a set of assets whose files have identical contents.
+type DuplicateGroup struct {
+	ContentHash string  `json:"content_hash"`
+	FileSize    int64   `json:"file_size"`
+	Assets      []Asset `json:"assets"`
+}
+
+// FindDuplicates groups assets that share a content hash, oldest asset first in each group.
+func (d *Database) FindDuplicates() ([]DuplicateGroup, error) {
 	rows, err := d.db.Query(`
-		SELECT a.id, a.absolute_path, a.filename, a.folder_id, a.file_size, a.modified_at, a.thumbnail, a.favorited, a.last_used_at, a.poly_count, a.created_at, a.updated_at
+		SELECT ` + assetColumns + `, a.content_hash
 		FROM assets a
-		LEFT JOIN asset_tags at ON at.asset_id = a.id
-		WHERE at.asset_id IS NULL
-		ORDER BY a.filename
+		WHERE a.trashed_at = '' AND a.content_hash IN (
+			SELECT content_hash FROM assets WHERE content_hash != '' AND trashed_at = ''
+			GROUP BY content_hash HAVING COUNT(*) > 1
+		)
+		ORDER BY a.content_hash, a.created_at, a.id
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var assets []Asset
+	var groups []DuplicateGroup
 	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		var hash string
+		a, err := d.scanAsset(rows, &hash)
+		if err != nil {
 			return nil, err
 		}
-		assets = append(assets, a)
+		if len(groups) == 0 || groups[len(groups)-1].ContentHash != hash {
+			groups = append(groups, DuplicateGroup{ContentHash: hash, FileSize: a.FileSize})
+		}
+		g := &groups[len(groups)-1]
+		g.Assets = append(g.Assets, a)
 	}
-	return assets, nil
+	return groups, nil
 }
 
-func (d *Database) GetFavoritedAssets() ([]Asset, error) {
-	rows, err := d.db.Query(`
-		SELECT id, absolute_path, filename, folder_id, file_size, modified_at, thumbnail, favorited, last_used_at, poly_count, created_at, updated_at
-		FROM assets WHERE favorited = 1 ORDER BY filename
-	`)
+// MergeDuplicates folds the tags, collection memberships, favorite flag and last-used
+// time of each duplicate into keepID. The duplicates themselves are left alone. Every
+// duplicate must have the same content hash as the kept asset.
+func (d *Database) MergeDuplicates(keepID int64, duplicateIDs []int64) error {
+	tx, err := d.db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var assets []Asset
-	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
+	var keepHash string
+	if err := tx.QueryRow("SELECT content_hash FROM assets WHERE id = ?", keepID).Scan(&keepHash); err != nil {
+		return err
+	}
+	if keepHash == "" {
+		return fmt.Errorf("asset %d has no content hash", keepID)
+	}
+
+	for _, id := range duplicateIDs {
+		if id == keepID {
+			continue
+		}
+		var hash string
+		if err := tx.QueryRow("SELECT content_hash FROM assets WHERE id = ?", id).Scan(&hash); err != nil {
+			return err
+		}
+		if hash != keepHash {
+			return fmt.Errorf("asset %d is not a duplicate of asset %d", id, keepID)
+		}
+
+		if _, err := tx.Exec("INSERT OR IGNORE INTO asset_tags (asset_id, tag_id) SELECT ?, tag_id FROM asset_tags WHERE asset_id = ?", keepID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO collection_assets (collection_id, asset_id, added_at) SELECT collection_id, ?, added_at FROM collection_assets WHERE asset_id = ?", keepID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE assets SET
+				favorited    = MAX(favorited, (SELECT favorited FROM assets WHERE id = ?)),
+				last_used_at = MAX(last_used_at, (SELECT last_used_at FROM assets WHERE id = ?))
+			WHERE id = ?
+		`, id, id, keepID); err != nil {
+			return err
 		}
-		assets = append(assets, a)
 	}
-	return assets, nil
+	return tx.Commit()
 }
 
-func (d *Database) ToggleFavorite(assetID int64) (bool, error) {
-	var current int
-	err := d.db.QueryRow("SELECT favorited FROM assets WHERE id = ?", assetID).Scan(&current)
-	if err != nil {
-		return false, err
-	}
-	newVal := 1 - current
-	_, err = d.db.Exec("UPDATE assets SET favorited = ? WHERE id = ?", newVal, assetID)
-	return newVal == 1, err
+// --- Untagged / Favorites / Recently Used ---
+
+func (d *Database) GetUntaggedAssets() ([]Asset, error) {
+	return d.FilterAssets(AssetFilter{Untagged: true}, "name", 0, 0)
+}
+
+func (d *Database) GetFavoritedAssets() ([]Asset, error) {
+	return d.FilterAssets(AssetFilter{Favorited: true}, "name", 0, 0)
 }
 
 func (d *Database) SetAssetUsed(assetID int64) error {
@@ -385,59 +515,49 @@ func (d *Database) BulkSetFavorite(assetIDs []int64, favorited bool) error {
 }
 
 func (d *Database) GetRecentlyUsedAssets(limit int) ([]Asset, error) {
-	rows, err := d.db.Query(`
-		SELECT id, absolute_path, filename, folder_id, file_size, modified_at, thumbnail, favorited, last_used_at, poly_count, created_at, updated_at
-		FROM assets WHERE last_used_at != '' ORDER BY last_used_at DESC LIMIT ?
-	`, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var assets []Asset
-	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		assets = append(assets, a)
-	}
-	return assets, nil
+	return d.queryAssets("SELECT "+assetColumns+" FROM assets a WHERE a.last_used_at != '' AND a.trashed_at = '' ORDER BY a.last_used_at DESC LIMIT ?", limit)
 }
 
 func (d *Database) GetRecentlyAddedAssets(limit int) ([]Asset, error) {
-	rows, err := d.db.Query(`
-		SELECT id, absolute_path, filename, folder_id, file_size, modified_at, thumbnail, favorited, last_used_at, poly_count, created_at, updated_at
-		FROM assets ORDER BY created_at DESC LIMIT ?
-	`, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var assets []Asset
-	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		assets = append(assets, a)
-	}
-	return assets, nil
+	return d.FilterAssets(AssetFilter{}, "-date-added", limit, 0)
 }
 
 // --- Tags ---
 
+// GetTag returns the tag with the given id.
+func (d *Database) GetTag(id int64) (*Tag, error) {
+	t := &Tag{ID: id}
+	if err := d.db.QueryRow("SELECT name FROM tags WHERE id = ?", id).Scan(&t.Name); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreateTag returns the tag with the given name, creating it and any missing
+// ancestors ("env/kitchen" for "env/kitchen/appliance"). Aliases resolve to
+// their tag, so the returned tag may have a different name.
 func (d *Database) CreateTag(name string) (*Tag, error) {
-	_, err := d.db.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", name)
+	name = normalizeTagName(name)
+	if name == "" {
+		return nil, errors.New("tag name can't be empty")
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if name, err = resolveTagAlias(tx, name); err != nil {
+		return nil, err
+	}
+	id, err := ensureTag(tx, name)
 	if err != nil {
 		return nil, err
 	}
-	// Always look up by name to get the correct ID
-	row := d.db.QueryRow("SELECT id, name FROM tags WHERE name = ?", name)
-	t := &Tag{}
-	err = row.Scan(&t.ID, &t.Name)
-	return t, err
+	// The tag may already exist spelled differently
+	if err := tx.QueryRow("SELECT name FROM tags WHERE id = ?", id).Scan(&name); err != nil {
+		return nil, err
+	}
+	return &Tag{ID: id, Name: name}, tx.Commit()
 }
 
 func (d *Database) ListTags() ([]Tag, error) {
@@ -460,17 +580,28 @@ func (d *Database) ListTags() ([]Tag, error) {
 
 // TagWithCount includes usage count for sorting by popularity.
 type TagWithCount struct {
-	ID    int64  `json:"id"`
-	Name  string `json:"name"`
-	Count int    `json:"count"`
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"` // 0 for a top-level tag
+	Count    int    `json:"count"`
 }
 
+// ListTagsWithCounts returns every tag, most used first. A tag's count includes
+// the assets of all its descendants, each asset counted once.
 func (d *Database) ListTagsWithCounts() ([]TagWithCount, error) {
 	rows, err := d.db.Query(`
-		SELECT t.id, t.name, COUNT(at.asset_id) as cnt
+		WITH RECURSIVE lineage(tag_id, ancestor_id) AS (
+			SELECT id, id FROM tags
+			UNION ALL
+			SELECT l.tag_id, t.parent_id FROM lineage l JOIN tags t ON t.id = l.ancestor_id
+			WHERE t.parent_id IS NOT NULL
+		)
+		SELECT t.id, t.name, COALESCE(t.parent_id, 0), COUNT(DISTINCT a.id) as cnt
 		FROM tags t
-		LEFT JOIN asset_tags at ON at.tag_id = t.id
-		GROUP BY t.id, t.name
+		LEFT JOIN lineage l ON l.ancestor_id = t.id
+		LEFT JOIN asset_tags at ON at.tag_id = l.tag_id
+		LEFT JOIN assets a ON a.id = at.asset_id AND a.trashed_at = ''
+		GROUP BY t.id
 		ORDER BY cnt DESC, t.name ASC
 	`)
 	if err != nil {
@@ -481,7 +612,7 @@ func (d *Database) ListTagsWithCounts() ([]TagWithCount, error) {
 	var tags []TagWithCount
 	for rows.Next() {
 		var t TagWithCount
-		if err := rows.Scan(&t.ID, &t.Name, &t.Count); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.ParentID, &t.Count); err != nil {
 			return nil, err
 		}
 		tags = append(tags, t)
@@ -489,6 +620,157 @@ func (d *Database) ListTagsWithCounts() ([]TagWithCount, error) {
 	return tags, nil
 }
 
+// RenameTag gives a tag a new name, which may move it elsewhere in the hierarchy;
+// its sub-tags move with it. Smart trays that filter on the old names are updated
+// to match. Renaming onto another tag's name fails; merge them instead.
+func (d *Database) RenameTag(id int64, name string) error {
+	name = normalizeTagName(name)
+	if name == "" {
+		return errors.New("tag name can't be empty")
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old string
+	if err := tx.QueryRow("SELECT name FROM tags WHERE id = ?", id).Scan(&old); err != nil {
+		return err
+	}
+	if name == old {
+		return nil
+	}
+	if strings.HasPrefix(name, old+tagSeparator) {
+		return fmt.Errorf("can't move %q inside itself", old)
+	}
+	var other int64
+	err = tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE AND id != ?", name, id).Scan(&other)
+	if err == nil {
+		return fmt.Errorf("a tag named %q already exists; merge into it instead", name)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	// Renaming a tag to one of its own aliases swaps them; another tag's alias
+	// is taken.
+	var aliasOf int64
+	var aliasOfName string
+	err = tx.QueryRow("SELECT t.id, t.name FROM tag_aliases al JOIN tags t ON t.id = al.tag_id WHERE al.alias = ?", name).Scan(&aliasOf, &aliasOfName)
+	switch {
+	case err == nil && aliasOf == id:
+		if _, err := tx.Exec("UPDATE tag_aliases SET alias = ? WHERE alias = ?", old, name); err != nil {
+			return err
+		}
+	case err == nil:
+		return fmt.Errorf("%q is an alias of %q", name, aliasOfName)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	if err := renameTagTree(tx, id, old, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MergeTags moves every asset tagged with one of sourceIDs over to targetID and
+// deletes the source tags, pointing smart trays that used them at the target.
+// Sub-tags of a source move under the target.
+func (d *Database) MergeTags(sourceIDs []int64, targetID int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range sourceIDs {
+		if id == targetID {
+			continue
+		}
+		if err := mergeTag(tx, id, targetID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTag removes a tag and its sub-tags from every asset and deletes them.
+func (d *Database) DeleteTag(id int64) error {
+	res, err := d.db.Exec("DELETE FROM tags WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteOrphanTags deletes tags that no asset has, returning how many went.
+// Parents of tags in use are kept.
+func (d *Database) DeleteOrphanTags() (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Count first: sub-tags removed by ON DELETE CASCADE don't show up in
+	// RowsAffected.
+	const orphans = `FROM tags WHERE id NOT IN (
+		WITH RECURSIVE used(id) AS (
+			SELECT tag_id FROM asset_tags
+			UNION SELECT t.parent_id FROM tags t JOIN used ON t.id = used.id
+			WHERE t.parent_id IS NOT NULL
+		) SELECT id FROM used
+	)`
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) " + orphans).Scan(&n); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE " + orphans); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// renameTagInSmartCollections rewrites tag terms for the from tags in every smart
+// tray query to name the tag to instead.
+func renameTagInSmartCollections(tx *sql.Tx, from []string, to string) error {
+	if len(from) == 0 {
+		return nil
+	}
+	rows, err := tx.Query("SELECT id, query FROM collections WHERE kind = ?", CollectionSmart)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	updated := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var query string
+		if err := rows.Scan(&id, &query); err != nil {
+			return err
+		}
+		if q, changed := renameTagTerms(query, from, to); changed {
+			updated[id] = q
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, q := range updated {
+		if _, err := tx.Exec("UPDATE collections SET query = ? WHERE id = ?", q, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *Database) TagAsset(assetID, tagID int64) error {
 	_, err := d.db.Exec("INSERT OR IGNORE INTO asset_tags (asset_id, tag_id) VALUES (?, ?)", assetID, tagID)
 	return err
@@ -534,6 +816,11 @@ func (d *Database) BulkTagAssets(assetIDs []int64, tagName string) error {
 }
 
 func (d *Database) BulkAddToCollection(collectionID int64, assetIDs []int64) error {
+	if kind, err := d.collectionKind(collectionID); err != nil {
+		return err
+	} else if kind == CollectionSmart {
+		return errSmartCollection
+	}
 	for _, aid := range assetIDs {
 		d.db.Exec("INSERT OR IGNORE INTO collection_assets (collection_id, asset_id) VALUES (?, ?)", collectionID, aid)
 	}
@@ -544,75 +831,37 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-// --- Assets by Tag ---
+// --- Settings ---
 
-func (d *Database) GetAssetsByTag(tagName string) ([]Asset, error) {
-	rows, err := d.db.Query(`
-		SELECT a.id, a.absolute_path, a.filename, a.folder_id, a.file_size, a.modified_at, a.thumbnail, a.favorited, a.last_used_at, a.poly_count, a.created_at, a.updated_at
-		FROM assets a
-		JOIN asset_tags at ON at.asset_id = a.id
-		JOIN tags t ON t.id = at.tag_id
-		WHERE t.name = ?
-		ORDER BY a.filename
-	`, tagName)
-	if err != nil {
-		return nil, err
+// GetSetting returns a stored preference, or def if it has never been set.
+func (d *Database) GetSetting(key, def string) string {
+	var value string
+	if err := d.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value); err != nil {
+		return def
 	}
-	defer rows.Close()
+	return value
+}
 
-	var assets []Asset
-	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		assets = append(assets, a)
-	}
-	return assets, nil
+// SetSetting stores a preference.
+func (d *Database) SetSetting(key, value string) error {
+	_, err := d.db.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
 }
 
-func (d *Database) GetAssetsByTags(tagNames []string) ([]Asset, error) {
-	if len(tagNames) == 0 {
-		return d.ListAssets()
-	}
-	// Build placeholders
-	placeholders := ""
-	args := make([]interface{}, len(tagNames))
-	for i, name := range tagNames {
-		if i > 0 {
-			placeholders += ","
-		}
-		placeholders += "?"
-		args[i] = name
-	}
-	args = append(args, len(tagNames))
+// --- Assets by Tag ---
 
-	query := fmt.Sprintf(`
-		SELECT a.id, a.absolute_path, a.filename, a.folder_id, a.file_size, a.modified_at, a.thumbnail, a.favorited, a.last_used_at, a.poly_count, a.created_at, a.updated_at
-		FROM assets a
-		JOIN asset_tags at ON at.asset_id = a.id
-		JOIN tags t ON t.id = at.tag_id
-		WHERE t.name IN (%s)
-		GROUP BY a.id
-		HAVING COUNT(DISTINCT t.id) = ?
-		ORDER BY a.filename
-	`, placeholders)
+func (d *Database) GetAssetsByTag(tagName string) ([]Asset, error) {
+	return d.FilterAssets(AssetFilter{AllTags: []string{tagName}}, "name", 0, 0)
+}
 
-	rows, err := d.db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (d *Database) GetAssetsByTags(tagNames []string) ([]Asset, error) {
+	return d.FilterAssets(AssetFilter{AllTags: tagNames}, "name", 0, 0)
+}
 
-	var assets []Asset
-	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		assets = append(assets, a)
-	}
-	return assets, nil
+// ListAssetsByTags pages through the assets that have every tag in include, at
+// least one in includeAny and none in exclude. Empty sets don't constrain.
+func (d *Database) ListAssetsByTags(include, includeAny, exclude []string, sort string, cursor string, limit int) (*AssetPage, error) {
+	return d.ListAssetsPage(AssetFilter{AllTags: include, AnyTags: includeAny, NoTags: exclude}, sort, cursor, limit)
 }
 
 // GetAssetIDsByTags returns IDs of assets that have ANY of the given tags.
@@ -620,24 +869,12 @@ func (d *Database) GetAssetIDsByTags(tagNames []string) ([]int64, error) {
 	if len(tagNames) == 0 {
 		return nil, nil
 	}
-	placeholders := ""
-	args := make([]interface{}, len(tagNames))
-	for i, name := range tagNames {
-		if i > 0 {
-			placeholders += ","
-		}
-		placeholders += "?"
-		args[i] = name
+	c, err := d.compileFilter(AssetFilter{AnyTags: tagNames})
+	if err != nil {
+		return nil, err
 	}
-	query := fmt.Sprintf(`
-		SELECT DISTINCT a.id
-		FROM assets a
-		JOIN asset_tags at ON at.asset_id = a.id
-		JOIN tags t ON t.id = at.tag_id
-		WHERE t.name IN (%s)
-	`, placeholders)
-
-	rows, err := d.db.Query(query, args...)
+	from, args := c.fromWhere()
+	rows, err := d.db.Query("SELECT a.id "+from, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -656,12 +893,23 @@ func (d *Database) GetAssetIDsByTags(tagNames []string) ([]int64, error) {
 
 // --- Collections ---
 
-// Collection represents a user-curated group of assets.
+// Collection kinds. Manual collections list their assets in collection_assets;
+// smart collections hold a query (see query.go) that is evaluated on every read.
+const (
+	CollectionManual = "manual"
+	CollectionSmart  = "smart"
+)
+
+var errSmartCollection = errors.New("smart trays are filled by their query; assets can't be added or removed by hand")
+
+// Collection represents a group of assets, either user-curated or defined by a saved query.
 type Collection struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Icon        string `json:"icon"`
+	Kind        string `json:"kind"`
+	Query       string `json:"query"`
 	AssetCount  int    `json:"asset_count"`
 	CreatedAt   string `json:"created_at"`
 }
@@ -678,24 +926,70 @@ func (d *Database) CreateCollection(name string, icon string) (*Collection, erro
 	return d.GetCollection(id)
 }
 
+// CreateSmartCollection makes a collection whose members are whatever matches query.
+func (d *Database) CreateSmartCollection(name string, icon string, query string) (*Collection, error) {
+	if _, err := compileQuery(query, nil); err != nil {
+		return nil, err
+	}
+	if icon == "" {
+		icon = "⚡"
+	}
+	res, err := d.db.Exec("INSERT INTO collections (name, icon, kind, query) VALUES (?, ?, ?, ?)", name, icon, CollectionSmart, query)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return d.GetCollection(id)
+}
+
+// SetCollectionQuery replaces a smart collection's query.
+func (d *Database) SetCollectionQuery(id int64, query string) error {
+	if _, err := compileQuery(query, nil); err != nil {
+		return err
+	}
+	res, err := d.db.Exec("UPDATE collections SET query = ? WHERE id = ? AND kind = ?", query, id, CollectionSmart)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("collection %d is not a smart tray", id)
+	}
+	return nil
+}
+
 func (d *Database) GetCollection(id int64) (*Collection, error) {
 	row := d.db.QueryRow(`
-		SELECT c.id, c.name, c.description, c.icon, c.created_at,
-			(SELECT COUNT(*) FROM collection_assets ca WHERE ca.collection_id = c.id) as asset_count
+		SELECT c.id, c.name, c.description, c.icon, c.kind, c.query, c.created_at,
+			(SELECT COUNT(*) FROM collection_assets ca JOIN assets a ON a.id = ca.asset_id
+				WHERE ca.collection_id = c.id AND a.trashed_at = '') as asset_count
 		FROM collections c WHERE c.id = ?
 	`, id)
 	c := &Collection{}
-	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Icon, &c.CreatedAt, &c.AssetCount)
+	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Icon, &c.Kind, &c.Query, &c.CreatedAt, &c.AssetCount)
 	if err != nil {
 		return nil, err
 	}
+	d.countSmartCollection(c)
 	return c, nil
 }
 
+// countSmartCollection fills in AssetCount for a smart collection by running its query.
+func (d *Database) countSmartCollection(c *Collection) {
+	if c.Kind != CollectionSmart {
+		return
+	}
+	n, err := d.CountQueryAssets(c.Query)
+	if err != nil {
+		fmt.Printf("[collections] warn: smart tray %q: %v\n", c.Name, err)
+	}
+	c.AssetCount = n
+}
+
 func (d *Database) ListCollections() ([]Collection, error) {
 	rows, err := d.db.Query(`
-		SELECT c.id, c.name, c.description, c.icon, c.created_at,
-			(SELECT COUNT(*) FROM collection_assets ca WHERE ca.collection_id = c.id) as asset_count
+		SELECT c.id, c.name, c.description, c.icon, c.kind, c.query, c.created_at,
+			(SELECT COUNT(*) FROM collection_assets ca JOIN assets a ON a.id = ca.asset_id
+				WHERE ca.collection_id = c.id AND a.trashed_at = '') as asset_count
 		FROM collections c
 		ORDER BY c.name
 	`)
@@ -707,14 +1001,26 @@ func (d *Database) ListCollections() ([]Collection, error) {
 	var collections []Collection
 	for rows.Next() {
 		var c Collection
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Icon, &c.CreatedAt, &c.AssetCount); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Icon, &c.Kind, &c.Query, &c.CreatedAt, &c.AssetCount); err != nil {
 			return nil, err
 		}
 		collections = append(collections, c)
 	}
+	rows.Close()
+
+	for i := range collections {
+		d.countSmartCollection(&collections[i])
+	}
 	return collections, nil
 }
 
+// collectionKind returns the kind of a collection.
+func (d *Database) collectionKind(id int64) (string, error) {
+	var kind string
+	err := d.db.QueryRow("SELECT kind FROM collections WHERE id = ?", id).Scan(&kind)
+	return kind, err
+}
+
 func (d *Database) RenameCollection(id int64, name string) error {
 	_, err := d.db.Exec("UPDATE collections SET name = ? WHERE id = ?", name, id)
 	return err
@@ -725,44 +1031,26 @@ func (d *Database) DeleteCollection(id int64) error {
 	return err
 }
 
-func (d *Database) AddAssetToCollection(collectionID, assetID int64) error {
-	_, err := d.db.Exec("INSERT OR IGNORE INTO collection_assets (collection_id, asset_id) VALUES (?, ?)", collectionID, assetID)
-	return err
-}
-
 func (d *Database) RemoveAssetFromCollection(collectionID, assetID int64) error {
+	if kind, err := d.collectionKind(collectionID); err != nil {
+		return err
+	} else if kind == CollectionSmart {
+		return errSmartCollection
+	}
 	_, err := d.db.Exec("DELETE FROM collection_assets WHERE collection_id = ? AND asset_id = ?", collectionID, assetID)
 	return err
 }
 
 func (d *Database) GetAssetsInCollection(collectionID int64) ([]Asset, error) {
-	rows, err := d.db.Query(`
-		SELECT a.id, a.absolute_path, a.filename, a.folder_id, a.file_size, a.modified_at, a.thumbnail, a.favorited, a.last_used_at, a.poly_count, a.created_at, a.updated_at
-		FROM assets a
-		JOIN collection_assets ca ON ca.asset_id = a.id
-		WHERE ca.collection_id = ?
-		ORDER BY a.filename
-	`, collectionID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var assets []Asset
-	for rows.Next() {
-		var a Asset
-		if err := rows.Scan(&a.ID, &a.AbsolutePath, &a.Filename, &a.FolderID, &a.FileSize, &a.ModifiedAt, &a.Thumbnail, &a.Favorited, &a.LastUsedAt, &a.PolyCount, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		assets = append(assets, a)
-	}
-	return assets, nil
+	return d.FilterAssets(AssetFilter{CollectionID: collectionID}, "name", 0, 0)
 }
 
+// GetCollectionsForAsset returns the manual collections an asset has been added to.
 func (d *Database) GetCollectionsForAsset(assetID int64) ([]Collection, error) {
 	rows, err := d.db.Query(`
-		SELECT c.id, c.name, c.description, c.icon, c.created_at,
-			(SELECT COUNT(*) FROM collection_assets ca2 WHERE ca2.collection_id = c.id) as asset_count
+		SELECT c.id, c.name, c.description, c.icon, c.kind, c.query, c.created_at,
+			(SELECT COUNT(*) FROM collection_assets ca2 JOIN assets a ON a.id = ca2.asset_id
+				WHERE ca2.collection_id = c.id AND a.trashed_at = '') as asset_count
 		FROM collections c
 		JOIN collection_assets ca ON ca.collection_id = c.id
 		WHERE ca.asset_id = ?
@@ -776,7 +1064,7 @@ func (d *Database) GetCollectionsForAsset(assetID int64) ([]Collection, error) {
 	var collections []Collection
 	for rows.Next() {
 		var c Collection
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Icon, &c.CreatedAt, &c.AssetCount); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Icon, &c.Kind, &c.Query, &c.CreatedAt, &c.AssetCount); err != nil {
 			return nil, err
 		}
 		collections = append(collections, c)
@@ -784,20 +1072,273 @@ func (d *Database) GetCollectionsForAsset(assetID int64) ([]Collection, error) {
 	return collections, nil
 }
 
-// --- Thumbnails ---
+// --- Model Metadata ---
 
-func (d *Database) SetThumbnail(assetID int64, base64PNG string) error {
-	_, err := d.db.Exec("UPDATE assets SET thumbnail = ? WHERE id = ?", base64PNG, assetID)
+// SetModelInfo stores metadata extracted from a model file. The triangle count
+// is written to poly_count, which the frontend also fills in after rendering.
+func (d *Database) SetModelInfo(assetID int64, info *ModelInfo, version int) error {
+	_, err := d.db.Exec(`
+		UPDATE assets SET
+			metadata_version = ?,
+			poly_count       = ?,
+			vertex_count     = ?,
+			mesh_count       = ?,
+			material_count   = ?,
+			texture_count    = ?,
+			animation_count  = ?,
+			skin_count       = ?,
+			node_count       = ?,
+			bounds_x         = ?,
+			bounds_y         = ?,
+			bounds_z         = ?,
+			generator        = ?,
+			copyright        = ?,
+			extensions_used  = ?,
+			search_names     = ?
+		WHERE id = ?
+	`, version, info.TriangleCount, info.VertexCount, info.MeshCount, info.MaterialCount,
+		info.TextureCount, info.AnimationCount, info.SkinCount, info.NodeCount,
+		info.Bounds[0], info.Bounds[1], info.Bounds[2],
+		info.Generator, info.Copyright, strings.Join(info.ExtensionsUsed, ","),
+		strings.Join(info.Names, "\n"), assetID)
 	return err
 }
 
+// --- Thumbnails ---
+
+// Thumbnails live in the ThumbnailCache; the assets.thumbnail column holds the
+// cache key, which is turned into a file server URL whenever an Asset is read.
+
+// SetThumbnailBaseURL sets the URL prefix thumbnail keys are served under.
+func (d *Database) SetThumbnailBaseURL(base string) {
+	d.thumbBaseURL = base
+}
+
+func (d *Database) thumbnailURL(key string) string {
+	if key == "" || d.thumbBaseURL == "" {
+		return ""
+	}
+	return d.thumbBaseURL + key
+}
+
+// SetThumbnail stores a thumbnail given as a base64 data URL (from canvas.toDataURL).
+func (d *Database) SetThumbnail(assetID int64, dataURL string) error {
+	data, ext, err := decodeDataURL(dataURL)
+	if err != nil {
+		return err
+	}
+	return d.SetThumbnailImage(assetID, data, ext)
+}
+
+// SetThumbnailImage writes an encoded image to the cache and points the asset at
+// it, removing the image it replaces.
+func (d *Database) SetThumbnailImage(assetID int64, data []byte, ext string) error {
+	var oldKey, hash string
+	err := d.db.QueryRow("SELECT thumbnail, content_hash FROM assets WHERE id = ?", assetID).Scan(&oldKey, &hash)
+	if err != nil {
+		return err
+	}
+	key, err := d.thumbs.Write(assetID, hash, "", data, ext)
+	if err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("UPDATE assets SET thumbnail = ? WHERE id = ?", key, assetID); err != nil {
+		d.thumbs.Remove(key)
+		return err
+	}
+	d.thumbs.Remove(oldKey)
+	return nil
+}
+
+// ClearThumbnail drops an asset's thumbnail and previews, e.g. because its file changed.
+func (d *Database) ClearThumbnail(assetID int64) error {
+	var key string
+	if err := d.db.QueryRow("SELECT thumbnail FROM assets WHERE id = ?", assetID).Scan(&key); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("UPDATE assets SET thumbnail = '' WHERE id = ?", assetID); err != nil {
+		return err
+	}
+	d.thumbs.Remove(key)
+	return d.clearPreviews(assetID)
+}
+
+// ThumbnailPath returns the cached image file for a thumbnail key.
+func (d *Database) ThumbnailPath(key string) (string, bool) {
+	return d.thumbs.Path(key)
+}
+
+// PruneThumbnails deletes cached images (thumbnails and previews) that no asset
+// refers to any more, such as those of deleted assets.
+func (d *Database) PruneThumbnails() (int, error) {
+	start := time.Now()
+	rows, err := d.db.Query(`
+		SELECT thumbnail FROM assets WHERE thumbnail != ''
+		UNION ALL SELECT turntable FROM asset_previews WHERE turntable != ''
+		UNION ALL SELECT views FROM asset_previews WHERE views != ''
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	keep := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return 0, err
+		}
+		keep[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return d.thumbs.Prune(keep, start), nil
+}
+
+// MissingThumbnails returns the ids of assets without a thumbnail whose filename
+// passes keep, in the grid's default (name) order. Offline assets can't be
+// rendered and are left out.
+func (d *Database) MissingThumbnails(keep func(filename string) bool) ([]int64, error) {
+	rows, err := d.db.Query("SELECT a.id, a.filename FROM assets a WHERE a.thumbnail = '' AND a.trashed_at = '' AND NOT " + offlineSQL + " ORDER BY a.filename")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if keep(name) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
 func (d *Database) SetPolyCount(assetID int64, count int64) error {
 	_, err := d.db.Exec("UPDATE assets SET poly_count = ? WHERE id = ?", count, assetID)
 	return err
 }
 
+// GetThumbnail returns the URL of an asset's thumbnail, or "" if it has none.
 func (d *Database) GetThumbnail(assetID int64) (string, error) {
-	var thumb string
-	err := d.db.QueryRow("SELECT thumbnail FROM assets WHERE id = ?", assetID).Scan(&thumb)
-	return thumb, err
+	var key string
+	err := d.db.QueryRow("SELECT thumbnail FROM assets WHERE id = ?", assetID).Scan(&key)
+	return d.thumbnailURL(key), err
+}
+
+// --- Previews ---
+
+// AssetPreviews are the extra views rendered alongside an asset's thumbnail.
+// Both images are horizontal strips of square frames.
+type AssetPreviews struct {
+	AssetID int64 `json:"asset_id"`
+	// Turntable is the URL of a strip of Frames views evenly spaced around the
+	// model, starting from the thumbnail's angle.
+	Turntable string `json:"turntable"`
+	Frames    int    `json:"frames"`
+	// Views is the URL of a strip of front, side and top orthographic views.
+	Views string `json:"views"`
+}
+
+// GetPreviews returns an asset's previews. An asset without any gets an empty
+// AssetPreviews rather than an error.
+func (d *Database) GetPreviews(assetID int64) (*AssetPreviews, error) {
+	p := &AssetPreviews{AssetID: assetID}
+	err := d.db.QueryRow("SELECT turntable, frames, views FROM asset_previews WHERE asset_id = ?", assetID).Scan(&p.Turntable, &p.Frames, &p.Views)
+	if err == sql.ErrNoRows {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Turntable = d.thumbnailURL(p.Turntable)
+	p.Views = d.thumbnailURL(p.Views)
+	return p, nil
+}
+
+// SetPreviews stores freshly rendered preview strips for an asset, replacing any
+// earlier ones.
+func (d *Database) SetPreviews(assetID int64, turntable []byte, frames int, views []byte) error {
+	var hash string
+	if err := d.db.QueryRow("SELECT content_hash FROM assets WHERE id = ?", assetID).Scan(&hash); err != nil {
+		return err
+	}
+	turntableKey, err := d.thumbs.Write(assetID, hash, "turntable", turntable, ".png")
+	if err != nil {
+		return err
+	}
+	viewsKey, err := d.thumbs.Write(assetID, hash, "views", views, ".png")
+	if err != nil {
+		d.thumbs.Remove(turntableKey)
+		return err
+	}
+	if err := d.clearPreviews(assetID); err != nil {
+		return err
+	}
+	_, err = d.db.Exec("INSERT INTO asset_previews (asset_id, turntable, frames, views) VALUES (?, ?, ?, ?)", assetID, turntableKey, frames, viewsKey)
+	if err != nil {
+		d.thumbs.Remove(turntableKey)
+		d.thumbs.Remove(viewsKey)
+	}
+	return err
+}
+
+// clearPreviews deletes an asset's previews and their cached images.
+func (d *Database) clearPreviews(assetID int64) error {
+	var turntable, views string
+	err := d.db.QueryRow("SELECT turntable, views FROM asset_previews WHERE asset_id = ?", assetID).Scan(&turntable, &views)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("DELETE FROM asset_previews WHERE asset_id = ?", assetID); err != nil {
+		return err
+	}
+	d.thumbs.Remove(turntable)
+	d.thumbs.Remove(views)
+	return nil
+}
+
+// MissingPreviews returns the ids of assets whose filename passes keep and that
+// have no previews, or a turntable with a different number of frames. Offline
+// assets are left out.
+func (d *Database) MissingPreviews(frames int, keep func(filename string) bool) ([]int64, error) {
+	rows, err := d.db.Query(`
+		SELECT a.id, a.filename FROM assets a
+		LEFT JOIN asset_previews p ON p.asset_id = a.id
+		WHERE (p.asset_id IS NULL OR p.frames != ?) AND a.trashed_at = '' AND NOT `+offlineSQL+`
+		ORDER BY a.filename
+	`, frames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if keep(name) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// HasPreviews reports whether an asset has previews with a turntable of the given length.
+func (d *Database) HasPreviews(assetID int64, frames int) bool {
+	var n int
+	d.db.QueryRow("SELECT COUNT(*) FROM asset_previews WHERE asset_id = ? AND frames = ?", assetID, frames).Scan(&n)
+	return n > 0
 }
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileIdentity returns the inode number of a file and the ID of the device holding
+// it, or zeros if they are unavailable. Inode numbers are only unique within a
+// device, so together with the file size both let the scanner recognise a file
+// that was moved. A watch folder's root also changes device when its drive is
+// unmounted.
+func fileIdentity(info fs.FileInfo) (inode, device int64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Ino), int64(st.Dev)
+	}
+	return 0, 0
+}
@@ -0,0 +1,10 @@
+package main
+
+import "io/fs"
+
+// fileIdentity returns zeros on Windows, where os.Stat does not expose a file
+// index. Move detection relies on content hashes there, and an unmounted drive's
+// folders are simply missing.
+func fileIdentity(info fs.FileInfo) (inode, device int64) {
+	return 0, 0
+}
@@ -1,32 +1,64 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-// LocalFileServer serves .glb/.gltf files on its own HTTP port.
+// allowedOrigins are the origins the app's own webview loads from: the Wails asset
+// server on each platform, plus the `wails dev` server.
+var allowedOrigins = map[string]bool{
+	"wails://wails":           true,
+	"wails://wails.localhost": true,
+	"http://wails.localhost":  true,
+	"https://wails.localhost": true,
+	"http://localhost:34115":  true,
+}
+
+// LocalFileServer serves model files on its own HTTP port.
 // This avoids issues with Wails' asset server and Vite proxying.
+//
+// Only files inside a registered watch folder are served, and every request must
+// carry the per-session Token so other local processes can't read through it.
 type LocalFileServer struct {
-	Port int
+	Port  int
+	Token string
+	db    *Database
 }
 
-func StartLocalFileServer() *LocalFileServer {
+func StartLocalFileServer(db *Database) *LocalFileServer {
+	s := &LocalFileServer{db: db}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		fmt.Printf("[fileserver] failed to generate token: %v\n", err)
+		return s
+	}
+	s.Token = hex.EncodeToString(tokenBytes)
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/localfile/", serveLocalFile)
+	mux.HandleFunc("/localfile/", s.serveLocalFile)
+	// The token is part of the path so that loaders resolving relative URIs
+	// (e.g. a .gltf's buffers and textures) keep it without any extra work.
+	mux.HandleFunc("GET /asset/{token}/{id}/{path...}", s.serveAssetFile)
+	mux.HandleFunc("GET /thumb/{token}/{key}", s.serveThumbnail)
 
 	// Find a free port
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		fmt.Printf("[fileserver] failed to listen: %v\n", err)
-		return &LocalFileServer{Port: 0}
+		return s
 	}
-	port := listener.Addr().(*net.TCPAddr).Port
-	fmt.Printf("[fileserver] serving on http://127.0.0.1:%d\n", port)
+	s.Port = listener.Addr().(*net.TCPAddr).Port
+	fmt.Printf("[fileserver] serving on http://127.0.0.1:%d\n", s.Port)
 
 	go func() {
 		if err := http.Serve(listener, mux); err != nil {
@@ -34,49 +66,206 @@ func StartLocalFileServer() *LocalFileServer {
 		}
 	}()
 
-	return &LocalFileServer{Port: port}
+	return s
+}
+
+// ThumbnailBaseURL is the prefix that thumbnail cache keys are served under.
+func (s *LocalFileServer) ThumbnailBaseURL() string {
+	if s.Port == 0 || s.Token == "" {
+		return ""
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d/thumb/%s/", s.Port, s.Token)
+}
+
+// authorize checks the request's origin and session token, writing an error response
+// if either is wrong.
+func (s *LocalFileServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if !allowedOrigins[origin] {
+			http.Error(w, "forbidden origin", http.StatusForbidden)
+			return false
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+	}
+
+	token := r.PathValue("token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		token = r.Header.Get("X-Sushi-Token")
+	}
+	if s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return false
+	}
+	return true
 }
 
-func serveLocalFile(w http.ResponseWriter, r *http.Request) {
+// resolveWatched resolves symlinks in path and returns the real path if it lies
+// inside one of the registered watch folders.
+func (s *LocalFileServer) resolveWatched(path string) (string, bool) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	folders, err := s.db.ListWatchFolders()
+	if err != nil {
+		return "", false
+	}
+	for _, f := range folders {
+		root, err := filepath.EvalSymlinks(f.Path)
+		if err != nil {
+			continue
+		}
+		if isWithinDir(root, real) {
+			return real, true
+		}
+	}
+	return "", false
+}
+
+// isWithinDir reports whether path is dir itself or somewhere beneath it.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *LocalFileServer) serveLocalFile(w http.ResponseWriter, r *http.Request) {
 	filePath := r.URL.Query().Get("path")
-	fmt.Printf("[fileserver] request: %s -> path=%s\n", r.URL.String(), filePath)
+	fmt.Printf("[fileserver] request: path=%s\n", filePath)
+
+	if !s.authorize(w, r) {
+		return
+	}
 
 	if filePath == "" {
 		http.Error(w, "missing path parameter", http.StatusBadRequest)
 		return
 	}
 
-	// Security: only serve .glb / .gltf files
-	lower := strings.ToLower(filePath)
-	if !strings.HasSuffix(lower, ".glb") && !strings.HasSuffix(lower, ".gltf") {
+	// Security: only serve registered model formats that live in a watch folder
+	realPath, ok := s.resolveWatched(filePath)
+	if !ok {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	format := formatForPath(realPath)
+	if format == nil {
 		http.Error(w, "forbidden file type", http.StatusForbidden)
 		return
 	}
 
-	// Check file exists
-	info, err := os.Stat(filePath)
+	serveFile(w, r, realPath, format.ContentType)
+}
+
+// resourceTypes are the sibling files a model may reference by relative URI.
+var resourceTypes = map[string]string{
+	".bin":  "application/octet-stream",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+	".ktx2": "image/ktx2",
+	".mtl":  "text/plain",
+}
+
+// serveAssetFile serves an asset by ID, along with any resources it references
+// relative to its own directory:
+//
+//	/asset/{token}/{id}/chair.gltf        the asset itself
+//	/asset/{token}/{id}/chair.bin         a sibling buffer
+//	/asset/{token}/{id}/textures/wood.png a texture in a subdirectory
+func (s *LocalFileServer) serveAssetFile(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad asset id", http.StatusBadRequest)
+		return
+	}
+	asset, err := s.db.GetAssetByID(id)
 	if err != nil {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	assetPath, ok := s.resolveWatched(asset.AbsolutePath)
+	if !ok {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+
+	rel := r.PathValue("path")
+	if rel == "" || rel == asset.Filename {
+		format := formatForPath(assetPath)
+		if format == nil {
+			http.Error(w, "forbidden file type", http.StatusForbidden)
+			return
+		}
+		serveFile(w, r, assetPath, format.ContentType)
+		return
+	}
+
+	// Resources must resolve (after following symlinks) to somewhere inside the asset's directory
+	dir := filepath.Dir(assetPath)
+	candidate := filepath.Join(dir, filepath.FromSlash(rel))
+	realPath, err := filepath.EvalSymlinks(candidate)
+	if err != nil || !isWithinDir(dir, realPath) {
 		http.Error(w, "file not found", http.StatusNotFound)
 		return
 	}
+	contentType, ok := resourceTypes[strings.ToLower(filepath.Ext(realPath))]
+	if !ok {
+		http.Error(w, "forbidden file type", http.StatusForbidden)
+		return
+	}
+	serveFile(w, r, realPath, contentType)
+}
 
-	// Set appropriate content type
-	contentType := "model/gltf-binary"
-	if strings.HasSuffix(lower, ".gltf") {
-		contentType = "model/gltf+json"
+// serveThumbnail serves an image from the thumbnail cache. Keys change whenever a
+// thumbnail is re-rendered, so responses can be cached indefinitely.
+func (s *LocalFileServer) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+	key := r.PathValue("key")
+	path, ok := s.db.ThumbnailPath(key)
+	if !ok {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
 	}
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	serveFile(w, r, path, thumbnailTypes[strings.ToLower(filepath.Ext(key))])
+}
+
+// serveFile streams a file that has already been authorized.
+func serveFile(w http.ResponseWriter, r *http.Request, path string, contentType string) {
+	// Check file exists
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	}
 
 	// Open and serve the file
-	f, err := os.Open(filePath)
+	f, err := os.Open(path)
 	if err != nil {
 		http.Error(w, "cannot open file", http.StatusInternalServerError)
 		return
 	}
 	defer f.Close()
 
-	http.ServeContent(w, r, filepath.Base(filePath), info.ModTime(), f)
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AssetFilter selects assets by any combination of criteria; every criterion
+// that is set must match. The zero value matches every asset outside the trash.
+type AssetFilter struct {
+	// AllTags, AnyTags and NoTags are tag names: the asset must have every tag
+	// in AllTags, at least one in AnyTags and none in NoTags.
+	AllTags []string `json:"all_tags"`
+	AnyTags []string `json:"any_tags"`
+	NoTags  []string `json:"no_tags"`
+	// CollectionID limits the results to one tray, manual or smart.
+	CollectionID int64 `json:"collection_id"`
+	// Folder is a directory; only assets beneath it match.
+	Folder    string `json:"folder"`
+	Favorited bool   `json:"favorited"`
+	Untagged  bool   `json:"untagged"`
+	// UsedSince is an RFC 3339 time or a date; only assets used since then match.
+	UsedSince string `json:"used_since"`
+	// Text is search box input in the query language (see query.go).
+	Text string `json:"text"`
+	// Trashed selects assets in the trash instead of the library.
+	Trashed bool `json:"trashed"`
+}
+
+// taggedSQL matches assets with at least one tag.
+const taggedSQL = "EXISTS (SELECT 1 FROM asset_tags at WHERE at.asset_id = a.id)"
+
+// add appends a condition and its arguments.
+func (c *compiledQuery) add(cond string, args ...interface{}) {
+	c.where = append(c.where, cond)
+	c.args = append(c.args, args...)
+}
+
+// merge adds the conditions and free text of another query.
+func (c *compiledQuery) merge(o *compiledQuery) {
+	c.where = append(c.where, o.where...)
+	c.args = append(c.args, o.args...)
+	c.text = strings.TrimSpace(c.text + " " + o.text)
+}
+
+// compileFilter translates a filter into SQL conditions over assets aliased as a.
+func (d *Database) compileFilter(f AssetFilter) (*compiledQuery, error) {
+	aliases, err := d.tagAliasMap()
+	if err != nil {
+		return nil, err
+	}
+	c, err := compileQuery(f.Text, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.CollectionID != 0 {
+		var kind, query string
+		if err := d.db.QueryRow("SELECT kind, query FROM collections WHERE id = ?", f.CollectionID).Scan(&kind, &query); err != nil {
+			return nil, err
+		}
+		if kind == CollectionSmart {
+			smart, err := compileQuery(query, aliases)
+			if err != nil {
+				return nil, fmt.Errorf("tray query: %w", err)
+			}
+			c.merge(smart)
+		} else {
+			c.add("EXISTS (SELECT 1 FROM collection_assets ca WHERE ca.asset_id = a.id AND ca.collection_id = ?)", f.CollectionID)
+		}
+	}
+
+	for _, name := range f.AllTags {
+		c.add(anyTagSQL(1), name)
+	}
+	if len(f.AnyTags) > 0 {
+		c.add(anyTagSQL(len(f.AnyTags)), stringArgs(f.AnyTags)...)
+	}
+	if len(f.NoTags) > 0 {
+		c.add("NOT "+anyTagSQL(len(f.NoTags)), stringArgs(f.NoTags)...)
+	}
+	if f.Untagged {
+		c.add("NOT " + taggedSQL)
+	}
+	if f.Trashed {
+		c.add("a.trashed_at != ''")
+	} else {
+		c.add("a.trashed_at = ''")
+	}
+
+	if f.Folder != "" {
+		prefix := strings.TrimSuffix(f.Folder, string(filepath.Separator)) + string(filepath.Separator)
+		c.add("substr(a.absolute_path, 1, length(?)) = ?", prefix, prefix)
+	}
+	if f.Favorited {
+		c.add("a.favorited = 1")
+	}
+	if f.UsedSince != "" {
+		since, err := time.Parse(time.RFC3339, f.UsedSince)
+		if err != nil {
+			if since, err = time.ParseInLocation("2006-01-02", f.UsedSince, time.Local); err != nil {
+				return nil, fmt.Errorf("used since: expected a time or a date like 2024-01-31, got %q", f.UsedSince)
+			}
+		}
+		c.add("datetime(a.last_used_at) >= ?", since.UTC().Format(sqliteTimeLayout))
+	}
+	return c, nil
+}
+
+// anyTagSQL matches assets that have any of n tags named (or aliased) by its
+// arguments, or any of their descendants.
+func anyTagSQL(n int) string {
+	return `a.id IN (SELECT asset_id FROM asset_tags WHERE tag_id IN (
+		` + tagSubtreeSQL(tagsNamedSQL(n)) + `))`
+}
+
+// placeholders returns n comma-separated SQL placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// FilterAssets returns the assets matching a filter in the given sort order (see
+// assetSorts). A limit of zero or less returns every match.
+func (d *Database) FilterAssets(f AssetFilter, sort string, limit int, offset int) ([]Asset, error) {
+	c, err := d.compileFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	order, err := orderBy(sort, c.text != "")
+	if err != nil {
+		return nil, err
+	}
+
+	from, args := c.fromWhere()
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit, offset)
+	return d.queryAssets(`
+		SELECT `+assetColumns+`
+		`+from+`
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, args...)
+}
+
+// CountAssets returns how many assets match a filter.
+func (d *Database) CountAssets(f AssetFilter) (int, error) {
+	c, err := d.compileFilter(f)
+	if err != nil {
+		return 0, err
+	}
+	from, args := c.fromWhere()
+	var n int
+	err = d.db.QueryRow("SELECT COUNT(*) "+from, args...).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Assets are stored by their path relative to their watch folder, with forward
+// slashes, so a library survives its folders mounting somewhere else (an
+// external drive, a synced directory on another machine). absolute_path is
+// derived from it and the folder's path, and kept for lookups by path.
+
+// relativePath returns path relative to root with forward slashes, or "" if
+// path isn't beneath root.
+func relativePath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// RelocateWatchFolder points a watch folder at a new path, moving its assets
+// along with it. Their rows, and so their tags, trays and thumbnails, are kept.
+func (d *Database) RelocateWatchFolder(id int64, path string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var other int64
+	err = tx.QueryRow("SELECT id FROM watch_folders WHERE path = ?", path).Scan(&other)
+	switch {
+	case err == nil && other != id:
+		return fmt.Errorf("%s is already a watch folder", path)
+	case err != nil && err != sql.ErrNoRows:
+		return err
+	}
+
+	var oldPath string
+	if err := tx.QueryRow("SELECT path FROM watch_folders WHERE id = ?", id).Scan(&oldPath); err != nil {
+		return err
+	}
+	// An empty root may be the mount point of a drive that isn't mounted yet, so
+	// its device is only recorded once it has files in it
+	var device int64
+	if info, err := os.Stat(path); err == nil && info.IsDir() && hasEntries(path) {
+		_, device = fileIdentity(info)
+	}
+	if _, err := tx.Exec("UPDATE watch_folders SET path = ?, device = ? WHERE id = ?", path, device, id); err != nil {
+		return err
+	}
+
+	// Rows from before relative paths were recorded get theirs from the old root
+	rows, err := tx.Query("SELECT id, absolute_path FROM assets WHERE folder_id = ? AND relative_path = ''", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rel := make(map[int64]string)
+	for rows.Next() {
+		var assetID int64
+		var p string
+		if err := rows.Scan(&assetID, &p); err != nil {
+			return err
+		}
+		if r := relativePath(oldPath, p); r != "" {
+			rel[assetID] = r
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	for assetID, r := range rel {
+		if _, err := tx.Exec("UPDATE assets SET relative_path = ? WHERE id = ?", r, assetID); err != nil {
+			return err
+		}
+	}
+
+	prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+	if _, err := tx.Exec(`
+		UPDATE assets SET absolute_path = ? || replace(relative_path, '/', ?)
+		WHERE folder_id = ? AND relative_path != ''
+	`, prefix, string(filepath.Separator), id); err != nil {
+		return fmt.Errorf("move assets: %w", err)
+	}
+	return tx.Commit()
+}
+
+// migrateRelativePaths records each asset's path within its watch folder.
+func migrateRelativePaths(tx *sql.Tx) error {
+	if err := addColumn(tx, "assets", "relative_path", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT a.id, a.absolute_path, w.path
+		FROM assets a JOIN watch_folders w ON w.id = a.folder_id
+		WHERE a.relative_path = ''
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rel := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var path, root string
+		if err := rows.Scan(&id, &path, &root); err != nil {
+			return err
+		}
+		rel[id] = relativePath(root, path)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, p := range rel {
+		if _, err := tx.Exec("UPDATE assets SET relative_path = ? WHERE id = ?", p, id); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_assets_relative_path
+		ON assets(folder_id, relative_path) WHERE relative_path != ''
+	`)
+	return err
+}
+
+// --- Offline folders ---
+
+// errFolderOffline is returned when a watch folder's root can't be reached.
+var errFolderOffline = errors.New("folder is offline")
+
+// offlineSQL matches assets, aliased as a, whose watch folder is offline.
+const offlineSQL = "a.folder_id IN (SELECT id FROM watch_folders WHERE offline_since != '')"
+
+// FolderReachable reports whether a watch folder's root can be read. A root that
+// is missing, or empty while the library still has assets there, is taken to be
+// the mount point of an unmounted drive, since scanning it would prune every one
+// of them. Only an empty root on the very device it was last seen on counts as
+// a folder whose files were really removed.
+func (d *Database) FolderReachable(folder WatchFolder) bool {
+	info, err := os.Stat(folder.Path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	if hasEntries(folder.Path) {
+		return true
+	}
+	var device int64
+	d.db.QueryRow("SELECT device FROM watch_folders WHERE id = ?", folder.ID).Scan(&device)
+	if _, current := fileIdentity(info); device != 0 && current == device {
+		return true
+	}
+	var known bool
+	d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM assets WHERE folder_id = ? AND trashed_at = '')", folder.ID).Scan(&known)
+	return !known
+}
+
+// hasEntries reports whether dir can be read and has anything in it.
+func hasEntries(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(1)
+	return len(names) > 0
+}
+
+// SetFolderOnline records whether a watch folder's root is reachable, and for a
+// reachable one, the device it is on. Assets in an offline folder stay in the
+// library, marked offline, until it's back.
+func (d *Database) SetFolderOnline(id int64, online bool) error {
+	if online {
+		var path string
+		if err := d.db.QueryRow("SELECT path FROM watch_folders WHERE id = ?", id).Scan(&path); err != nil {
+			return err
+		}
+		var device int64
+		if info, err := os.Stat(path); err == nil {
+			_, device = fileIdentity(info)
+		}
+		_, err := d.db.Exec("UPDATE watch_folders SET offline_since = '', device = ? WHERE id = ?", device, id)
+		return err
+	}
+	nowStr := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.db.Exec("UPDATE watch_folders SET offline_since = ? WHERE id = ? AND offline_since = ''", nowStr, id)
+	return err
+}
+
+// migrateOfflineFolders adds the column recording when a folder went offline.
+func migrateOfflineFolders(tx *sql.Tx) error {
+	return addColumn(tx, "watch_folders", "offline_since", "TEXT NOT NULL DEFAULT ''")
+}
+
+// migrateFolderDevices adds the column recording which device a folder's root
+// was last seen on.
+func migrateFolderDevices(tx *sql.Tx) error {
+	return addColumn(tx, "watch_folders", "device", "INTEGER NOT NULL DEFAULT 0")
+}
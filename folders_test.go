@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFolderReachable(t *testing.T) {
+	tests := []struct {
+		name    string
+		missing bool // the root doesn't exist
+		files   bool // the root has something in it
+		assets  bool // the library has assets in the folder
+		seen    bool // the root's device has been recorded
+		moved   bool // the root was last seen on another device
+		trashed bool // the library's assets are all in the trash
+		want    bool
+	}{
+		{name: "missing root", missing: true, assets: true},
+		{name: "empty root, unknown device, known assets", assets: true},
+		{name: "empty root, unknown device, no assets", want: true},
+		{name: "empty root, unknown device, trashed assets", assets: true, trashed: true, want: true},
+		{name: "empty root on its own device", assets: true, seen: true, want: true},
+		{name: "empty root on another device", assets: true, moved: true},
+		{name: "root with files on another device", files: true, assets: true, moved: true, want: true},
+		{name: "root with files, unknown device", files: true, assets: true, want: true},
+		{name: "root with files on its own device", files: true, assets: true, seen: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDatabase(t)
+			root := filepath.Join(t.TempDir(), "library")
+			if err := os.Mkdir(root, 0755); err != nil {
+				t.Fatal(err)
+			}
+			folder, err := d.AddWatchFolder(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.seen {
+				if err := d.SetFolderOnline(folder.ID, true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.moved {
+				if _, err := d.db.Exec("UPDATE watch_folders SET device = -1 WHERE id = ?", folder.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.assets {
+				a := addTestAsset(t, d, folder, "props/crate.glb", 100)
+				if tt.trashed {
+					if err := d.TrashAsset(a.ID, filepath.Join(t.TempDir(), "crate.glb")); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if tt.files {
+				if err := os.WriteFile(filepath.Join(root, "crate.glb"), []byte("glTF"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.missing {
+				os.Remove(root)
+			}
+
+			if got := d.FolderReachable(*folder); got != tt.want {
+				t.Errorf("FolderReachable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelocateWatchFolder(t *testing.T) {
+	d := newTestDatabase(t)
+	oldRoot := filepath.Join(t.TempDir(), "library")
+	folder, err := d.AddWatchFolder(oldRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crate := addTestAsset(t, d, folder, "props/crate.glb", 100)
+	legacy := addTestAsset(t, d, folder, "props/barrel.glb", 100)
+	if _, err := d.db.Exec("UPDATE assets SET relative_path = '' WHERE id = ?", legacy.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot := filepath.Join(t.TempDir(), "moved")
+	if err := os.Mkdir(newRoot, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RelocateWatchFolder(folder.ID, newRoot); err != nil {
+		t.Fatalf("RelocateWatchFolder: %v", err)
+	}
+	for _, a := range []*Asset{crate, legacy} {
+		got, err := d.GetAssetByID(a.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := filepath.Join(newRoot, filepath.FromSlash(got.RelativePath))
+		if got.RelativePath == "" || got.AbsolutePath != want {
+			t.Errorf("%s moved to %q (relative %q), want %q", a.Filename, got.AbsolutePath, got.RelativePath, want)
+		}
+	}
+
+	// The new root is empty, so it might be an unmounted drive
+	var device int64
+	d.db.QueryRow("SELECT device FROM watch_folders WHERE id = ?", folder.ID).Scan(&device)
+	if device != 0 {
+		t.Errorf("recorded device %d for an empty root", device)
+	}
+	folder.Path = newRoot
+	if d.FolderReachable(*folder) {
+		t.Errorf("empty new root with assets counts as reachable")
+	}
+
+	if err := os.WriteFile(filepath.Join(newRoot, "crate.glb"), []byte("glTF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RelocateWatchFolder(folder.ID, newRoot); err != nil {
+		t.Fatalf("RelocateWatchFolder: %v", err)
+	}
+	info, err := os.Stat(newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want := fileIdentity(info)
+	d.db.QueryRow("SELECT device FROM watch_folders WHERE id = ?", folder.ID).Scan(&device)
+	if device != want {
+		t.Errorf("recorded device %d, want %d", device, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// MetadataExtractor reads model metadata from a file of a particular format.
+type MetadataExtractor interface {
+	// Extract parses the file at path. It must not load more than it needs.
+	Extract(path string) (*ModelInfo, error)
+	// Version is bumped whenever the extractor starts producing new or better
+	// data, so previously indexed files get re-read on the next scan.
+	Version() int
+}
+
+// ModelFormat describes a file type the scanner indexes.
+type ModelFormat struct {
+	// Name is the short identifier passed to the Blender bridge, e.g. "gltf".
+	Name string
+	// Extensions are the lowercase file extensions (with dot) for this format.
+	Extensions []string
+	// ContentType is sent by the local file server.
+	ContentType string
+	// Extractor reads geometry stats; nil means files are indexed by size and mtime only.
+	Extractor MetadataExtractor
+}
+
+// modelFormats maps a lowercase extension to its format.
+var modelFormats = map[string]*ModelFormat{}
+
+// RegisterFormat makes a format known to the scanner, file server and Blender bridge.
+func RegisterFormat(f *ModelFormat) {
+	for _, ext := range f.Extensions {
+		modelFormats[ext] = f
+	}
+}
+
+func init() {
+	RegisterFormat(&ModelFormat{Name: "glb", Extensions: []string{".glb"}, ContentType: "model/gltf-binary", Extractor: gltfExtractor{}})
+	RegisterFormat(&ModelFormat{Name: "gltf", Extensions: []string{".gltf"}, ContentType: "model/gltf+json", Extractor: gltfExtractor{}})
+	RegisterFormat(&ModelFormat{Name: "obj", Extensions: []string{".obj"}, ContentType: "model/obj", Extractor: objExtractor{}})
+	RegisterFormat(&ModelFormat{Name: "stl", Extensions: []string{".stl"}, ContentType: "model/stl", Extractor: stlExtractor{}})
+	RegisterFormat(&ModelFormat{Name: "ply", Extensions: []string{".ply"}, ContentType: "application/octet-stream", Extractor: plyExtractor{}})
+	RegisterFormat(&ModelFormat{Name: "fbx", Extensions: []string{".fbx"}, ContentType: "application/octet-stream"})
+	RegisterFormat(&ModelFormat{Name: "dae", Extensions: []string{".dae"}, ContentType: "model/vnd.collada+xml"})
+	RegisterFormat(&ModelFormat{Name: "usdz", Extensions: []string{".usdz"}, ContentType: "model/vnd.usdz+zip"})
+	RegisterFormat(&ModelFormat{Name: "blend", Extensions: []string{".blend"}, ContentType: "application/x-blender"})
+}
+
+// formatForPath returns the registered format for a filename, or nil.
+func formatForPath(name string) *ModelFormat {
+	return modelFormats[strings.ToLower(filepath.Ext(name))]
+}
+
+// isAssetFile reports whether a filename has an extension we index.
+func isAssetFile(name string) bool {
+	return formatForPath(name) != nil
+}
+
+// gltfExtractor adapts ParseGLTFFile to the MetadataExtractor interface.
+type gltfExtractor struct{}
+
+func (gltfExtractor) Extract(path string) (*ModelInfo, error) { return ParseGLTFFile(path) }
+func (gltfExtractor) Version() int                            { return gltfMetadataVersion }
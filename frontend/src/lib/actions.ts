@@ -6,50 +6,70 @@ import {
   AddWatchFolder,
   GetWatchFolders,
   RemoveWatchFolder,
+  RelocateWatchFolder,
   GetAssets,
-  GetAssetsByTag,
-  GetAssetsByTags,
-  GetAssetIDsByTags,
+  QueryAssets,
+  FilterAssets,
+  ListAssetsPage,
   GetAllTags,
   GetTagsWithCounts,
   GetTagsForAsset,
   AddTagToAsset,
   RemoveTagFromAsset,
+  RenameTag,
+  MergeTags,
+  DeleteTag,
+  DeleteUnusedTags,
+  GetTagAliases,
+  AddTagAlias,
+  RemoveTagAlias,
   BulkTagAssets,
   BulkAddToCollection,
   SaveThumbnail,
   SavePolyCount,
   CreateCollection,
+  CreateSmartCollection,
   GetCollections,
   DeleteCollection,
   AddToCollection,
   RemoveFromCollection,
-  GetCollectionAssets,
   GetCollectionsForAsset,
   GetFileServerURL,
+  GetFileServerToken,
   ToggleFavorite,
   MarkAssetUsed,
-  GetUntaggedAssets,
-  GetFavoritedAssets,
-  GetRecentlyAddedAssets,
-  GetRecentlyUsedAssets,
   BulkSetFavorite,
   DeleteAsset,
   BulkDeleteAssets,
+  RestoreAssets,
+  EmptyTrash,
+  Undo,
+  Redo,
+  BackupLibrary,
+  ExportLibrary,
+  ImportLibrary,
   ClearAllThumbnails,
+  GetThumbnailRenderer,
+  SetThumbnailRenderer,
+  RenderThumbnailsInBackground,
+  GetPreviewSettings,
+  SetPreviewSettings,
+  GetAssetPreviews,
 } from "../../wailsjs/go/main/App.js";
-import { ClipboardSetText } from "../../wailsjs/runtime/runtime.js";
-import { renderThumbnail } from "./thumbnails";
-import type { Asset } from "./types";
+import { ClipboardSetText, EventsOn } from "../../wailsjs/runtime/runtime.js";
+import { renderThumbnail, checkWebGL } from "./thumbnails";
+import type { Asset, AssetPreviews, Tag, TagAlias } from "./types";
 import {
   assets,
   watchFolders,
   allTags,
   tagsWithCounts,
+  tagAliases,
   collections,
   loading,
   filterTag,
   filterTags,
+  anyTags,
   excludeTags,
   activeCollectionId,
   activeView,
@@ -63,12 +83,19 @@ import {
   showBulkActions,
   detailPanelOpen,
   thumbnailCache,
+  thumbnailRenderer,
+  previewSettings,
+  previewCache,
   fileServerBase,
+  fileServerToken,
   blenderConnected,
   toastMessage,
   toastVisible,
   displayedAssets,
   filteredAssets,
+  searchQuery,
+  searchRanks,
+  searchError,
 } from "./stores";
 import type { ViewId, SortField, SortDirection } from "./stores";
 import { activeFolderPath } from "./stores";
@@ -85,21 +112,46 @@ export function showToast(msg: string) {
 
 // --- Thumbnails ---
 
-export async function generateMissingThumbnails() {
+function isGLTF(filename: string): boolean {
+  const lower = filename.toLowerCase();
+  return lower.endsWith(".glb") || lower.endsWith(".gltf");
+}
+
+// Renders thumbnails for glTF assets that lack them. Returns true if rendering was
+// handed to the backend's CPU renderer, whose results arrive as thumbnail:ready events.
+export async function generateMissingThumbnails(): Promise<boolean> {
+  const mode = await GetThumbnailRenderer().catch(() => "auto");
+  thumbnailRenderer.set(mode === "cpu" ? "cpu" : "auto");
+  if (mode === "cpu" || !checkWebGL()) {
+    const cache = { ...get(thumbnailCache) };
+    for (const asset of get(assets)) {
+      if (asset.thumbnail) cache[asset.id] = asset.thumbnail;
+    }
+    thumbnailCache.set(cache);
+    const queued = await RenderThumbnailsInBackground().catch(() => 0);
+    console.log(`[sushi] Thumbnails: ${queued} queued for the CPU renderer`);
+    return true;
+  }
+
   let base = get(fileServerBase);
+  let token = get(fileServerToken);
   if (!base) {
     try {
-      base = await GetFileServerURL();
+      [base, token] = await Promise.all([
+        GetFileServerURL(),
+        GetFileServerToken(),
+      ]);
       fileServerBase.set(base);
+      fileServerToken.set(token);
       console.log("[sushi] File server URL:", base);
     } catch (e) {
       console.error("[sushi] Failed to get file server URL:", e);
-      return;
+      return false;
     }
   }
   if (!base) {
     console.warn("[sushi] No file server available, skipping thumbnails");
-    return;
+    return false;
   }
 
   const currentAssets = get(assets);
@@ -109,6 +161,9 @@ export async function generateMissingThumbnails() {
   const cache = { ...get(thumbnailCache) };
 
   for (const asset of currentAssets) {
+    // Three.js previews only handle glTF; other formats get stats from the scanner
+    if (!isGLTF(asset.filename)) continue;
+
     if (asset.thumbnail && asset.poly_count > 0) {
       cache[asset.id] = asset.thumbnail;
       cached++;
@@ -123,8 +178,10 @@ export async function generateMissingThumbnails() {
     }
 
     try {
-      const url = `${base}/localfile/?path=${encodeURIComponent(asset.absolute_path)}`;
-      const result = await renderThumbnail(url);
+      // Asset-scoped URLs let a .gltf pull in its sibling .bin and texture files
+      const resourcePath = `${base}/asset/${token}/${asset.id}/`;
+      const url = resourcePath + encodeURIComponent(asset.filename);
+      const result = await renderThumbnail(url, resourcePath);
       if (result) {
         if (!needsPolyOnly) {
           cache[asset.id] = result.dataUrl;
@@ -146,12 +203,82 @@ export async function generateMissingThumbnails() {
   console.log(
     `[sushi] Thumbnails: ${cached} cached, ${generated} generated, ${failed} failed`,
   );
+  return false;
+}
+
+// --- Previews ---
+
+export async function loadPreviewSettings() {
+  try {
+    previewSettings.set(await GetPreviewSettings());
+  } catch (e) {
+    console.error("Failed to load preview settings:", e);
+  }
+}
+
+export async function setPreviewsEnabled(enabled: boolean) {
+  const settings = { ...get(previewSettings), enabled };
+  try {
+    await SetPreviewSettings(settings);
+    previewSettings.set(settings);
+    showToast(
+      enabled
+        ? "Rendering turntables in the background…"
+        : "Turntable previews turned off",
+    );
+  } catch (e) {
+    showToast("Failed to change preview settings");
+  }
+}
+
+// Fetches an asset's turntable and orthographic views once; later renders
+// arrive through previews:ready events.
+export async function loadPreviews(assetId: number) {
+  if (!get(previewSettings).enabled || get(previewCache)[assetId]) return;
+  try {
+    const previews = await GetAssetPreviews(assetId);
+    if (previews?.turntable) {
+      previewCache.update((cache) => {
+        cache[assetId] = previews;
+        return cache;
+      });
+    }
+  } catch (e) {
+    console.warn("Failed to load previews:", e);
+  }
+}
+
+// CSS that shows one square frame of a horizontal sprite strip, scaled to fill
+// the element.
+export function spriteFrameStyle(
+  url: string,
+  frames: number,
+  frame: number,
+): string {
+  const x = frames > 1 ? (frame / (frames - 1)) * 100 : 0;
+  return `background-image: url("${url}"); background-size: ${frames * 100}% 100%; background-position: ${x}% 0;`;
+}
+
+export async function setThumbnailRenderer(mode: "auto" | "cpu") {
+  try {
+    await SetThumbnailRenderer(mode);
+    thumbnailRenderer.set(mode);
+    showToast(
+      mode === "cpu"
+        ? "Thumbnails now render in the background"
+        : "Thumbnails now render with WebGL",
+    );
+    generateMissingThumbnails();
+  } catch (e) {
+    showToast("Failed to change thumbnail renderer");
+  }
 }
 
 export async function regenerateAllThumbnails() {
   try {
     const count = await ClearAllThumbnails();
     thumbnailCache.set({});
+    previewCache.set({});
     // Clear in-memory thumbnail fields so generateMissing picks them all up
     assets.update((all) =>
       all.map((a) => ({ ...a, thumbnail: "", poly_count: 0 })),
@@ -160,8 +287,12 @@ export async function regenerateAllThumbnails() {
       all.map((a) => ({ ...a, thumbnail: "", poly_count: 0 })),
     );
     showToast(`Cleared ${count} thumbnails — regenerating…`);
-    await generateMissingThumbnails();
-    showToast("All thumbnails regenerated!");
+    const background = await generateMissingThumbnails();
+    showToast(
+      background
+        ? "Rendering thumbnails in the background…"
+        : "All thumbnails regenerated!",
+    );
   } catch (e) {
     showToast("Failed to clear thumbnails");
   }
@@ -172,12 +303,13 @@ export async function regenerateAllThumbnails() {
 export async function loadData() {
   loading.set(true);
   try {
-    const [a, f, t, c, tc] = await Promise.all([
+    const [a, f, t, c, tc, al] = await Promise.all([
       GetAssets(),
       GetWatchFolders(),
       GetAllTags(),
       GetCollections(),
       GetTagsWithCounts(),
+      GetTagAliases(),
     ]);
     assets.set(a || []);
     displayedAssets.set(a || []);
@@ -185,10 +317,12 @@ export async function loadData() {
     allTags.set(t || []);
     collections.set(c || []);
     tagsWithCounts.set(tc || []);
+    tagAliases.set(al || []);
   } catch (e) {
     console.error("Failed to load data:", e);
   }
   loading.set(false);
+  loadPreviewSettings();
   generateMissingThumbnails();
 }
 
@@ -202,67 +336,145 @@ export function startBlenderPolling() {
   return setInterval(check, 5000);
 }
 
+// --- Live updates ---
+
+// Subscribes to watcher events from the backend. Returns an unsubscribe function.
+export function startWatchEvents() {
+  const offChanged = EventsOn("assets:changed", () => {
+    applyFilter(true);
+    GetTagsWithCounts()
+      .then((tc) => tagsWithCounts.set(tc || []))
+      .catch(() => {});
+  });
+  const offStatus = EventsOn(
+    "folder:status",
+    (ev: { folder_id: number; online: boolean }) => {
+      const folder = get(watchFolders).find((f) => f.id === ev.folder_id);
+      const name = folder ? folder.path : "Watch folder";
+      showToast(ev.online ? `${name} is back online` : `${name} went offline`);
+      // Offline assets stay listed, marked as such, until the folder is back
+      GetWatchFolders()
+        .then((f) => watchFolders.set(f || []))
+        .catch(() => {});
+      const mark = (a: Asset) =>
+        a.folder_id === ev.folder_id ? { ...a, offline: !ev.online } : a;
+      assets.update((all) => all.map(mark));
+      displayedAssets.update((all) => all.map(mark));
+      const sa = get(selectedAsset);
+      if (sa) selectedAsset.set(mark(sa));
+    },
+  );
+  const offThumbnail = EventsOn(
+    "thumbnail:ready",
+    (ev: { asset_id: number; thumbnail: string }) => {
+      thumbnailCache.update((cache) => {
+        cache[ev.asset_id] = ev.thumbnail;
+        return cache;
+      });
+    },
+  );
+  const offPreviews = EventsOn("previews:ready", (ev: AssetPreviews) => {
+    previewCache.update((cache) => {
+      cache[ev.asset_id] = ev;
+      return cache;
+    });
+  });
+  return () => {
+    offChanged();
+    offStatus();
+    offThumbnail();
+    offPreviews();
+  };
+}
+
+// --- Search ---
+
+const SEARCH_DEBOUNCE_MS = 150;
+
+// Keeps searchRanks in step with the search box, re-running the query whenever the
+// displayed list reloads (tags or files may have changed). The box accepts the
+// backend query language, e.g. "crate tag:prop poly<5000". Returns an unsubscribe function.
+export function startSearchSync() {
+  let timer: ReturnType<typeof setTimeout> | undefined;
+  let seq = 0;
+
+  const run = () => {
+    clearTimeout(timer);
+    const q = get(searchQuery).trim();
+    if (!q) {
+      seq++;
+      searchRanks.set(null);
+      searchError.set("");
+      return;
+    }
+    timer = setTimeout(async () => {
+      const mine = ++seq;
+      try {
+        const results = (await QueryAssets(q, "", 0, 0)) || [];
+        if (mine !== seq) return;
+        searchRanks.set(new Map(results.map((a, i) => [a.id, i])));
+        searchError.set("");
+      } catch (e) {
+        // Parse errors come back as strings naming the offending term
+        if (mine === seq) searchError.set(String(e));
+      }
+    }, SEARCH_DEBOUNCE_MS);
+  };
+
+  const offQuery = searchQuery.subscribe(run);
+  const offAssets = displayedAssets.subscribe(run);
+  return () => {
+    clearTimeout(timer);
+    offQuery();
+    offAssets();
+  };
+}
+
 // --- Filtering ---
 
-export async function applyFilter() {
-  loading.set(true);
-  const colId = get(activeCollectionId);
-  const fTags = get(filterTags);
-  const fTag = get(filterTag);
+// How many assets the recent views show
+const RECENT_LIMIT = 200;
+
+export async function applyFilter(quiet = false) {
+  if (!quiet) loading.set(true);
   const view = get(activeView);
-  const folderPath = get(activeFolderPath);
+  const fTag = get(filterTag);
+  // Every active sidebar filter is combined into one backend query
+  const filter = {
+    all_tags: fTag ? [...get(filterTags), fTag] : get(filterTags),
+    any_tags: get(anyTags),
+    no_tags: get(excludeTags),
+    collection_id: get(activeCollectionId) ?? 0,
+    folder: get(activeFolderPath) ?? "",
+    favorited: view === "favorites",
+    untagged: view === "untagged",
+    // Used at all, for the recently used view
+    used_since: view === "recent-used" ? new Date(0).toISOString() : "",
+    text: "",
+    trashed: view === "trash",
+  };
   try {
     let result: Asset[];
-    if (colId !== null) {
-      result = (await GetCollectionAssets(colId)) || [];
-    } else if (fTags.length > 0) {
-      result = (await GetAssetsByTags(fTags)) || [];
-    } else if (fTag) {
-      result = (await GetAssetsByTag(fTag)) || [];
+    if (view === "recent-added" || view === "recent-used") {
+      const sort = view === "recent-added" ? "-date-added" : "-last-used";
+      const page = await ListAssetsPage(filter, sort, "", RECENT_LIMIT);
+      result = page.assets || [];
     } else {
-      // Apply smart view
-      switch (view) {
-        case "untagged":
-          result = (await GetUntaggedAssets()) || [];
-          break;
-        case "favorites":
-          result = (await GetFavoritedAssets()) || [];
-          break;
-        case "recent-added":
-          result = (await GetRecentlyAddedAssets()) || [];
-          break;
-        case "recent-used":
-          result = (await GetRecentlyUsedAssets()) || [];
-          break;
-        default:
-          result = (await GetAssets()) || [];
-          break;
-      }
-      if (view === "all") assets.set(result);
-    }
-
-    // Apply folder filter on top
-    if (folderPath) {
-      result = result.filter(
-        (a) =>
-          a.absolute_path.startsWith(folderPath + "/") ||
-          a.absolute_path === folderPath,
-      );
+      result = (await FilterAssets(filter, "name")) || [];
     }
-
-    // Apply exclude-tag filter on top
-    const exTags = get(excludeTags);
-    if (exTags.length > 0) {
-      const excludedIds = (await GetAssetIDsByTags(exTags)) || [];
-      const excludeSet = new Set(excludedIds);
-      result = result.filter((a) => !excludeSet.has(a.id));
-    }
-
+    const unfiltered =
+      view === "all" &&
+      !filter.collection_id &&
+      !filter.folder &&
+      !filter.all_tags.length &&
+      !filter.any_tags.length &&
+      !filter.no_tags.length;
+    if (unfiltered) assets.set(result);
     displayedAssets.set(result);
   } catch (e) {
     console.error("Filter failed:", e);
   }
-  loading.set(false);
+  if (!quiet) loading.set(false);
   generateMissingThumbnails();
 }
 
@@ -270,11 +482,9 @@ export function toggleTagFilter(tag: string) {
   activeCollectionId.set(null);
   activeView.set("all");
   filterTag.set("");
-  // Remove from excludes if present
-  const excl = get(excludeTags);
-  if (excl.includes(tag)) {
-    excludeTags.set(excl.filter((t) => t !== tag));
-  }
+  // A tag is in at most one of the include, any and exclude sets
+  excludeTags.update((tags) => tags.filter((t) => t !== tag));
+  anyTags.update((tags) => tags.filter((t) => t !== tag));
   const current = get(filterTags);
   const idx = current.indexOf(tag);
   if (idx >= 0) {
@@ -287,6 +497,7 @@ export function toggleTagFilter(tag: string) {
 
 export function clearTagFilters() {
   filterTags.set([]);
+  anyTags.set([]);
   excludeTags.set([]);
   filterTag.set("");
   activeCollectionId.set(null);
@@ -297,10 +508,8 @@ export function clearTagFilters() {
 
 export function toggleExcludeTag(tag: string) {
   // If the tag is currently included, remove it from includes first
-  const incl = get(filterTags);
-  if (incl.includes(tag)) {
-    filterTags.set(incl.filter((t) => t !== tag));
-  }
+  filterTags.update((tags) => tags.filter((t) => t !== tag));
+  anyTags.update((tags) => tags.filter((t) => t !== tag));
   const current = get(excludeTags);
   const idx = current.indexOf(tag);
   if (idx >= 0) {
@@ -311,6 +520,19 @@ export function toggleExcludeTag(tag: string) {
   applyFilter();
 }
 
+// Toggles a tag in the any-of set: assets need at least one of those tags.
+export function toggleAnyTag(tag: string) {
+  activeCollectionId.set(null);
+  activeView.set("all");
+  filterTag.set("");
+  filterTags.update((tags) => tags.filter((t) => t !== tag));
+  excludeTags.update((tags) => tags.filter((t) => t !== tag));
+  anyTags.update((tags) =>
+    tags.includes(tag) ? tags.filter((t) => t !== tag) : [...tags, tag],
+  );
+  applyFilter();
+}
+
 export function clearExcludeTags() {
   excludeTags.set([]);
   applyFilter();
@@ -327,6 +549,7 @@ export function setTagFilter(tag: string) {
 export function setCollectionFilter(id: number | null) {
   filterTag.set("");
   filterTags.set([]);
+  anyTags.set([]);
   activeView.set("all");
   activeFolderPath.set(null);
   activeCollectionId.update((current) => (current === id ? null : id));
@@ -338,6 +561,7 @@ export function setCollectionFilter(id: number | null) {
 export function setActiveView(view: ViewId) {
   filterTag.set("");
   filterTags.set([]);
+  anyTags.set([]);
   activeCollectionId.set(null);
   activeFolderPath.set(null);
   activeView.set(view);
@@ -542,7 +766,7 @@ export async function deleteSelectedAsset() {
     detailPanelOpen.set(false);
     selectedAssetTags.set([]);
     selectedAssetCollections.set([]);
-    showToast(`Deleted "${sa.filename}"`);
+    showToast(`Moved "${sa.filename}" to the trash`);
     await applyFilter();
   } catch (e) {
     showToast("Failed to delete asset");
@@ -558,13 +782,144 @@ export async function bulkDeleteAssets() {
     showBulkActions.set(false);
     selectedAsset.set(null);
     detailPanelOpen.set(false);
-    showToast(`Deleted ${count} assets`);
+    showToast(`Moved ${count} assets to the trash`);
     await applyFilter();
   } catch (e) {
     showToast("Failed to delete assets");
   }
 }
 
+export async function restoreSelectedAsset() {
+  const sa = get(selectedAsset);
+  if (!sa) return;
+  try {
+    await RestoreAssets([sa.id]);
+    selectedAsset.set(null);
+    detailPanelOpen.set(false);
+    showToast(`Restored "${sa.filename}"`);
+    await afterTrashChange();
+  } catch (e) {
+    showToast(`Couldn't restore: ${e}`);
+  }
+}
+
+export async function bulkRestoreAssets() {
+  const ids = get(selectedAssetIds);
+  if (ids.size === 0) return;
+  try {
+    const count = await RestoreAssets([...ids]);
+    selectedAssetIds.set(new Set());
+    showBulkActions.set(false);
+    selectedAsset.set(null);
+    detailPanelOpen.set(false);
+    showToast(
+      count === ids.size
+        ? `Restored ${count} assets`
+        : `Restored ${count} of ${ids.size} assets`,
+    );
+    await afterTrashChange();
+  } catch (e) {
+    showToast(`Couldn't restore: ${e}`);
+  }
+}
+
+export async function emptyTrash() {
+  try {
+    const count = await EmptyTrash();
+    selectedAsset.set(null);
+    detailPanelOpen.set(false);
+    showToast(
+      count
+        ? `Permanently deleted ${count} asset${count !== 1 ? "s" : ""}`
+        : "The trash is empty",
+    );
+    await afterTrashChange();
+  } catch (e) {
+    showToast("Failed to empty the trash");
+  }
+}
+
+// Restored assets come back with their tags and trays, so their counts change.
+async function afterTrashChange() {
+  const [tc, c] = await Promise.all([GetTagsWithCounts(), GetCollections()]);
+  tagsWithCounts.set(tc || []);
+  collections.set(c || []);
+  await applyFilter();
+}
+
+// --- Undo ---
+
+export function undo() {
+  return stepHistory(Undo, "Undid", "Nothing to undo");
+}
+
+export function redo() {
+  return stepHistory(Redo, "Redid", "Nothing to redo");
+}
+
+async function stepHistory(
+  step: () => Promise<string>,
+  done: string,
+  nothing: string,
+) {
+  try {
+    const label = await step();
+    if (!label) return showToast(nothing);
+    await afterTagChange();
+    // Refresh the open asset, which may have changed or left the view
+    const sa = get(selectedAsset);
+    if (sa) {
+      const fresh = get(displayedAssets).find((a) => a.id === sa.id);
+      if (fresh) {
+        selectedAsset.set(fresh);
+        selectedAssetCollections.set(
+          (await GetCollectionsForAsset(sa.id)) || [],
+        );
+      } else {
+        selectedAsset.set(null);
+        detailPanelOpen.set(false);
+      }
+    }
+    showToast(`${done}: ${label}`);
+  } catch (e) {
+    showToast(`${e}`);
+  }
+}
+
+// --- Backup ---
+
+export async function backupLibrary() {
+  try {
+    const path = await BackupLibrary("");
+    if (path) showToast(`Backed up library to ${path}`);
+  } catch (e) {
+    showToast(`Backup failed: ${e}`);
+  }
+}
+
+export async function exportLibrary() {
+  try {
+    const path = await ExportLibrary("");
+    if (path) showToast(`Exported library to ${path}`);
+  } catch (e) {
+    showToast(`Export failed: ${e}`);
+  }
+}
+
+export async function importLibrary() {
+  try {
+    const summary = await ImportLibrary("");
+    if (!summary) return;
+    await loadData();
+    showToast(
+      `Imported ${summary.matched} asset${summary.matched !== 1 ? "s" : ""}` +
+        (summary.unmatched ? ` — ${summary.unmatched} not found here` : ""),
+    );
+  } catch (e) {
+    showToast(`Import failed: ${e}`);
+  }
+}
+
 // --- Hover quick-add ---
 
 export async function hoverAddToCollection(
@@ -600,6 +955,20 @@ export async function addFolder() {
   }
 }
 
+export async function relocateFolder(id: number) {
+  try {
+    const updatedAssets = await RelocateWatchFolder(id, "");
+    assets.set(updatedAssets || []);
+    watchFolders.set((await GetWatchFolders()) || []);
+    activeFolderPath.set(null);
+    await applyFilter();
+    const folder = get(watchFolders).find((f) => f.id === id);
+    if (folder) showToast(`Folder now at ${folder.path}`);
+  } catch (e) {
+    showToast(`Failed to relocate folder: ${e}`);
+  }
+}
+
 export async function removeFolder(id: number) {
   try {
     await RemoveWatchFolder(id);
@@ -705,6 +1074,120 @@ export async function removeTag(tagId: number) {
   }
 }
 
+// --- Tag management ---
+
+async function reloadTags() {
+  const [t, tc, al] = await Promise.all([
+    GetAllTags(),
+    GetTagsWithCounts(),
+    GetTagAliases(),
+  ]);
+  allTags.set(t || []);
+  tagsWithCounts.set(tc || []);
+  tagAliases.set(al || []);
+  const sa = get(selectedAsset);
+  if (sa) selectedAssetTags.set((await GetTagsForAsset(sa.id)) || []);
+}
+
+// Points the active tag filters at a renamed or merged tag, or drops a deleted one.
+function replaceFilterTag(from: string, to: string | null) {
+  const swap = (tags: string[]) => {
+    const out = tags.filter((t) => t !== from);
+    if (to !== null && tags.includes(from) && !out.includes(to)) out.push(to);
+    return out;
+  };
+  filterTags.update(swap);
+  anyTags.update(swap);
+  excludeTags.update(swap);
+  filterTag.update((t) => (t === from ? (to ?? "") : t));
+}
+
+// Reloads everything a tag change can touch. Smart tray queries follow renames.
+async function afterTagChange() {
+  await reloadTags();
+  collections.set((await GetCollections()) || []);
+  applyFilter(true);
+}
+
+export async function renameTag(tag: Tag, name: string): Promise<boolean> {
+  const newName = name.trim().toLowerCase();
+  try {
+    await RenameTag(tag.id, newName);
+  } catch (e) {
+    showToast(`Couldn't rename tag: ${e}`);
+    return false;
+  }
+  replaceFilterTag(tag.name, newName);
+  await afterTagChange();
+  showToast(`Renamed #${tag.name} to #${newName}`);
+  return true;
+}
+
+export async function mergeTagInto(tag: Tag, target: Tag): Promise<boolean> {
+  try {
+    await MergeTags([tag.id], target.id);
+  } catch (e) {
+    showToast(`Couldn't merge tags: ${e}`);
+    return false;
+  }
+  replaceFilterTag(tag.name, target.name);
+  await afterTagChange();
+  showToast(`Merged #${tag.name} into #${target.name}`);
+  return true;
+}
+
+export async function deleteTag(tag: Tag): Promise<boolean> {
+  try {
+    await DeleteTag(tag.id);
+  } catch (e) {
+    showToast(`Couldn't delete tag: ${e}`);
+    return false;
+  }
+  replaceFilterTag(tag.name, null);
+  await afterTagChange();
+  showToast(`Deleted #${tag.name}`);
+  return true;
+}
+
+// Makes alias another name for a tag; a tag already called that is merged in.
+export async function addTagAlias(tag: Tag, alias: string): Promise<boolean> {
+  const name = alias.trim().toLowerCase();
+  if (!name) return false;
+  try {
+    await AddTagAlias(name, tag.id);
+  } catch (e) {
+    showToast(`Couldn't add alias: ${e}`);
+    return false;
+  }
+  replaceFilterTag(name, tag.name);
+  await afterTagChange();
+  showToast(`#${name} now means #${tag.name}`);
+  return true;
+}
+
+export async function removeTagAlias(alias: TagAlias) {
+  try {
+    await RemoveTagAlias(alias.alias);
+    await reloadTags();
+  } catch (e) {
+    showToast("Failed to remove alias");
+  }
+}
+
+export async function deleteUnusedTags() {
+  try {
+    const count = await DeleteUnusedTags();
+    await reloadTags();
+    showToast(
+      count
+        ? `Removed ${count} unused tag${count !== 1 ? "s" : ""}`
+        : "No unused tags",
+    );
+  } catch (e) {
+    showToast("Failed to remove unused tags");
+  }
+}
+
 // --- Favorites ---
 
 export async function toggleFavorite(assetId: number) {
@@ -755,15 +1238,26 @@ export const SUGGESTED_TAGS = [
   "modular",
 ];
 
-export async function createCollection(name: string, icon: string) {
-  if (!name.trim()) return;
+export async function createCollection(
+  name: string,
+  icon: string,
+  query = "",
+): Promise<boolean> {
+  if (!name.trim()) return false;
   try {
-    await CreateCollection(name.trim(), icon);
+    if (query.trim()) {
+      await CreateSmartCollection(name.trim(), icon, query.trim());
+    } else {
+      await CreateCollection(name.trim(), icon);
+    }
     const c = await GetCollections();
     collections.set(c || []);
     showToast("Tray created");
+    return true;
   } catch (e) {
-    showToast("Failed to create tray");
+    // Smart tray query errors name the offending term
+    showToast(query.trim() ? `Invalid filter: ${e}` : "Failed to create tray");
+    return false;
   }
 }
 
@@ -833,10 +1327,22 @@ export function formatPoly(count: number): string {
   return count.toString();
 }
 
+// The file's extension, such as ".obj", for placeholders without a thumbnail.
+export function fileExtension(filename: string): string {
+  const dot = filename.lastIndexOf(".");
+  return dot > 0 ? filename.slice(dot).toLowerCase() : "";
+}
+
+export function formatDimensions(asset: Asset): string {
+  const fmt = (n: number) => (n >= 10 ? n.toFixed(1) : n.toFixed(2));
+  return `${fmt(asset.bounds_x)} × ${fmt(asset.bounds_y)} × ${fmt(asset.bounds_z)}`;
+}
+
 export function viewLabel(): string {
   const colId = get(activeCollectionId);
   const cols = get(collections);
   const fTags = get(filterTags);
+  const aTags = get(anyTags);
   const fTag = get(filterTag);
   const view = get(activeView);
   const folderPath = get(activeFolderPath);
@@ -846,8 +1352,11 @@ export function viewLabel(): string {
   if (colId !== null) {
     const col = cols.find((c) => c.id === colId);
     label = col ? `${col.icon} ${col.name}` : "Tray";
-  } else if (fTags.length > 0) {
-    label = fTags.map((t) => `#${t}`).join(" + ");
+  } else if (fTags.length > 0 || aTags.length > 0) {
+    const all = fTags.map((t) => `#${t}`);
+    const anyOf = aTags.map((t) => `#${t}`).join(" | ");
+    if (anyOf) all.push(fTags.length > 0 && aTags.length > 1 ? `(${anyOf})` : anyOf);
+    label = all.join(" + ");
   } else if (fTag) {
     label = `#${fTag}`;
   } else {
@@ -864,6 +1373,9 @@ export function viewLabel(): string {
       case "recent-used":
         label = "🕐 Recently Used";
         break;
+      case "trash":
+        label = "🗑 Trash";
+        break;
       default:
         label = "All assets";
         break;
@@ -4,7 +4,10 @@ import type {
   WatchFolder,
   Tag,
   TagWithCount,
+  TagAlias,
   Collection,
+  AssetPreviews,
+  PreviewSettings,
 } from "./types";
 
 // --- Core data ---
@@ -12,13 +15,33 @@ export const assets = writable<Asset[]>([]);
 export const watchFolders = writable<WatchFolder[]>([]);
 export const allTags = writable<Tag[]>([]);
 export const tagsWithCounts = writable<TagWithCount[]>([]);
+export const tagAliases = writable<TagAlias[]>([]);
 export const collections = writable<Collection[]>([]);
+// Trays that assets can be added to by hand
+export const manualCollections = derived(collections, ($collections) =>
+  $collections.filter((c) => c.kind !== "smart"),
+);
 
 // --- UI state ---
 export const loading = writable(true);
 export const searchQuery = writable("");
+// Backend query results for the search box (asset id -> position), or null while
+// no query is active or results are still loading.
+export const searchRanks = writable<Map<number, number> | null>(null);
+// Parse error for the current query, shown under the search box.
+export const searchError = writable("");
+
+// A query with free-text words is ranked by relevance; one made only of
+// field terms like "tag:prop poly<5000" keeps the chosen sort.
+function hasFreeText(query: string): boolean {
+  return query
+    .split(/\s+/)
+    .some((word) => word && !/^-?[a-z]+[:<>=]/i.test(word));
+}
 export const filterTag = writable("");
 export const filterTags = writable<string[]>([]);
+// Tags of which an asset needs at least one (shift-click in the tag bar)
+export const anyTags = writable<string[]>([]);
 export const excludeTags = writable<string[]>([]);
 export const activeCollectionId = writable<number | null>(null);
 
@@ -28,7 +51,8 @@ export type ViewId =
   | "untagged"
   | "recent-added"
   | "recent-used"
-  | "favorites";
+  | "favorites"
+  | "trash";
 export const activeView = writable<ViewId>("all");
 
 // --- Folder browser ---
@@ -40,7 +64,8 @@ export type SortField =
   | "date-added"
   | "file-modified"
   | "file-size"
-  | "poly-count";
+  | "poly-count"
+  | "last-used";
 export type SortDirection = "asc" | "desc";
 export const sortField = writable<SortField>("name");
 export const sortDirection = writable<SortDirection>("asc");
@@ -56,7 +81,15 @@ export const detailPanelOpen = writable(false);
 
 // --- Thumbnails ---
 export const thumbnailCache = writable<Record<number, string>>({});
+// "auto" renders with WebGL when the webview has it; "cpu" always uses the backend
+export const thumbnailRenderer = writable<"auto" | "cpu">("auto");
+export const previewSettings = writable<PreviewSettings>({
+  enabled: false,
+  frames: 12,
+});
+export const previewCache = writable<Record<number, AssetPreviews>>({});
 export const fileServerBase = writable("");
+export const fileServerToken = writable("");
 
 // --- Blender ---
 export const blenderConnected = writable(false);
@@ -73,12 +106,25 @@ export const displayedAssets = writable<Asset[]>([]);
 
 // Derived: filteredAssets applies search + sorting on top of displayedAssets
 export const filteredAssets = derived(
-  [displayedAssets, searchQuery, sortField, sortDirection],
-  ([$displayedAssets, $searchQuery, $sortField, $sortDirection]) => {
+  [displayedAssets, searchQuery, searchRanks, sortField, sortDirection],
+  ([
+    $displayedAssets,
+    $searchQuery,
+    $searchRanks,
+    $sortField,
+    $sortDirection,
+  ]) => {
     let result = $displayedAssets;
 
-    // Search filter
-    if ($searchQuery.trim()) {
+    // Search filter: backend query results, best match first for free text
+    if ($searchQuery.trim() && $searchRanks) {
+      const ranks = $searchRanks;
+      result = result.filter((a) => ranks.has(a.id));
+      if (hasFreeText($searchQuery)) {
+        return result.sort((a, b) => ranks.get(a.id)! - ranks.get(b.id)!);
+      }
+    } else if ($searchQuery.trim()) {
+      // Filename match while the backend query is in flight
       const q = $searchQuery.trim().toLowerCase();
       result = result.filter((a) => a.filename.toLowerCase().includes(q));
     }
@@ -105,6 +151,8 @@ export const filteredAssets = derived(
           return dir * (a.file_size - b.file_size);
         case "poly-count":
           return dir * ((a.poly_count || 0) - (b.poly_count || 0));
+        case "last-used":
+          return dir * (a.last_used_at || "").localeCompare(b.last_used_at || "");
         default:
           return 0;
       }
@@ -9,7 +9,8 @@ let camera: THREE.PerspectiveCamera | null = null;
 let loader: GLTFLoader | null = null;
 let webglAvailable: boolean | null = null;
 
-function checkWebGL(): boolean {
+/** Whether the webview can render thumbnails itself. */
+export function checkWebGL(): boolean {
   if (webglAvailable !== null) return webglAvailable;
   try {
     const testCanvas = document.createElement("canvas");
@@ -90,11 +91,13 @@ export interface ThumbnailResult {
 
 /**
  * Render a GLB/GLTF file to a base64 PNG thumbnail.
- * Expects a URL like "/localfile/?path=..." served by the Go backend.
+ * Expects a URL like "/asset/{token}/{id}/chair.gltf" served by the Go backend;
+ * external buffers and textures are resolved relative to resourcePath.
  * Returns null if WebGL is unavailable.
  */
 export async function renderThumbnail(
   url: string,
+  resourcePath: string,
 ): Promise<ThumbnailResult | null> {
   if (!ensureRenderer()) {
     console.warn("[sushi] Skipping thumbnail — no WebGL");
@@ -129,7 +132,7 @@ export async function renderThumbnail(
 
     // Parse with GLTFLoader
     const gltf = await new Promise<any>((resolve, reject) => {
-      loader!.parse(buffer, "", resolve, reject);
+      loader!.parse(buffer, resourcePath, resolve, reject);
     });
 
     return renderGLTF(gltf);
@@ -1,22 +1,39 @@
 export interface Asset {
   id: number;
   absolute_path: string;
+  relative_path: string;
   filename: string;
   file_size: number;
   folder_id: number;
   modified_at: string;
-  thumbnail: string;
+  thumbnail: string; // URL on the local file server, or ""
   favorited: number;
   last_used_at: string;
   poly_count: number;
+  vertex_count: number;
+  mesh_count: number;
+  material_count: number;
+  texture_count: number;
+  animation_count: number;
+  skin_count: number;
+  node_count: number;
+  bounds_x: number;
+  bounds_y: number;
+  bounds_z: number;
+  generator: string;
+  copyright: string;
+  extensions_used: string;
   created_at: string;
   updated_at: string;
+  trashed_at: string; // "" unless the asset is in the trash
+  offline: boolean; // its watch folder can't be reached
 }
 
 export interface WatchFolder {
   id: number;
   path: string;
   created_at: string;
+  offline_since: string; // "" while the folder is reachable
 }
 
 export interface Tag {
@@ -27,14 +44,38 @@ export interface Tag {
 export interface TagWithCount {
   id: number;
   name: string;
+  parent_id: number; // 0 for a top-level tag
   count: number;
 }
 
+export interface TagAlias {
+  alias: string;
+  tag_id: number;
+  tag_name: string;
+}
+
 export interface Collection {
   id: number;
   name: string;
   description: string;
   icon: string;
+  // Smart trays hold a query instead of a hand-picked list of assets
+  kind: "manual" | "smart";
+  query: string;
   asset_count: number;
   created_at: string;
 }
+
+// Extra views rendered alongside the thumbnail; both images are horizontal
+// strips of square frames. Empty strings when they haven't been rendered.
+export interface AssetPreviews {
+  asset_id: number;
+  turntable: string;
+  frames: number;
+  views: string; // front, side, top
+}
+
+export interface PreviewSettings {
+  enabled: boolean;
+  frames: number;
+}
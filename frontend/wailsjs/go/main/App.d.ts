@@ -2,12 +2,16 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function AddTagAlias(arg1:string,arg2:number):Promise<void>;
+
 export function AddTagToAsset(arg1:number,arg2:string):Promise<Array<main.Tag>>;
 
 export function AddToCollection(arg1:number,arg2:number):Promise<void>;
 
 export function AddWatchFolder():Promise<Array<main.Asset>>;
 
+export function BackupLibrary(arg1:string):Promise<string>;
+
 export function BulkAddToCollection(arg1:number,arg2:Array<number>):Promise<void>;
 
 export function BulkDeleteAssets(arg1:Array<number>):Promise<number>;
@@ -20,18 +24,36 @@ export function ClearAllThumbnails():Promise<number>;
 
 export function CreateCollection(arg1:string,arg2:string):Promise<main.Collection>;
 
+export function CreateSmartCollection(arg1:string,arg2:string,arg3:string):Promise<main.Collection>;
+
 export function DeleteAsset(arg1:number):Promise<void>;
 
 export function DeleteCollection(arg1:number):Promise<void>;
 
+export function DeleteTag(arg1:number):Promise<void>;
+
+export function DeleteUnusedTags():Promise<number>;
+
+export function EmptyTrash():Promise<number>;
+
+export function ExportLibrary(arg1:string):Promise<string>;
+
+export function FilterAssets(arg1:main.AssetFilter,arg2:string):Promise<Array<main.Asset>>;
+
+export function FindDuplicates():Promise<Array<main.DuplicateGroup>>;
+
 export function GetAllTags():Promise<Array<main.Tag>>;
 
 export function GetAssetIDsByTags(arg1:Array<string>):Promise<Array<number>>;
 
+export function GetAssetPreviews(arg1:number):Promise<main.AssetPreviews>;
+
 export function GetAssets():Promise<Array<main.Asset>>;
 
 export function GetAssetsByTag(arg1:string):Promise<Array<main.Asset>>;
 
+export function GetAssetsByTagSets(arg1:Array<string>,arg2:Array<string>,arg3:Array<string>,arg4:string,arg5:string,arg6:number):Promise<main.AssetPage>;
+
 export function GetAssetsByTags(arg1:Array<string>):Promise<Array<main.Asset>>;
 
 export function GetCollectionAssets(arg1:number):Promise<Array<main.Asset>>;
@@ -42,42 +64,84 @@ export function GetCollectionsForAsset(arg1:number):Promise<Array<main.Collectio
 
 export function GetFavoritedAssets():Promise<Array<main.Asset>>;
 
+export function GetFileServerToken():Promise<string>;
+
 export function GetFileServerURL():Promise<string>;
 
+export function GetPreviewSettings():Promise<main.PreviewSettings>;
+
 export function GetRecentlyAddedAssets():Promise<Array<main.Asset>>;
 
 export function GetRecentlyUsedAssets():Promise<Array<main.Asset>>;
 
+export function GetTagAliases():Promise<Array<main.TagAlias>>;
+
+export function GetTagTree():Promise<Array<main.TagNode>>;
+
 export function GetTagsForAsset(arg1:number):Promise<Array<main.Tag>>;
 
 export function GetTagsWithCounts():Promise<Array<main.TagWithCount>>;
 
 export function GetThumbnail(arg1:number):Promise<string>;
 
+export function GetThumbnailRenderer():Promise<string>;
+
 export function GetUntaggedAssets():Promise<Array<main.Asset>>;
 
 export function GetWatchFolders():Promise<Array<main.WatchFolder>>;
 
+export function ImportLibrary(arg1:string):Promise<main.ImportSummary>;
+
+export function ListAssetsPage(arg1:main.AssetFilter,arg2:string,arg3:string,arg4:number):Promise<main.AssetPage>;
+
 export function MarkAssetUsed(arg1:number):Promise<void>;
 
+export function MergeTags(arg1:Array<number>,arg2:number):Promise<void>;
+
 export function OpenFileInFolder(arg1:string):Promise<void>;
 
 export function PingBlender():Promise<main.BlenderStatus>;
 
+export function QueryAssets(arg1:string,arg2:string,arg3:number,arg4:number):Promise<Array<main.Asset>>;
+
+export function Redo():Promise<string>;
+
+export function RelocateWatchFolder(arg1:number,arg2:string):Promise<Array<main.Asset>>;
+
 export function RemoveFromCollection(arg1:number,arg2:number):Promise<void>;
 
+export function RemoveTagAlias(arg1:string):Promise<void>;
+
 export function RemoveTagFromAsset(arg1:number,arg2:number):Promise<Array<main.Tag>>;
 
 export function RemoveWatchFolder(arg1:number):Promise<void>;
 
 export function RenameCollection(arg1:number,arg2:string):Promise<void>;
 
+export function RenameTag(arg1:number,arg2:string):Promise<void>;
+
+export function RenderThumbnailsInBackground():Promise<number>;
+
 export function RescanFolder(arg1:number):Promise<Array<main.Asset>>;
 
+export function ResolveDuplicates(arg1:number,arg2:Array<number>,arg3:boolean):Promise<main.Asset>;
+
+export function RestoreAssets(arg1:Array<number>):Promise<number>;
+
 export function SavePolyCount(arg1:number,arg2:number):Promise<void>;
 
 export function SaveThumbnail(arg1:number,arg2:string):Promise<void>;
 
+export function SearchAssets(arg1:string):Promise<Array<main.Asset>>;
+
 export function SendToBlender(arg1:Array<string>):Promise<main.BlenderStatus>;
 
+export function SetPreviewSettings(arg1:main.PreviewSettings):Promise<void>;
+
+export function SetThumbnailRenderer(arg1:string):Promise<void>;
+
 export function ToggleFavorite(arg1:number):Promise<boolean>;
+
+export function Undo():Promise<string>;
+
+export function UpdateSmartCollection(arg1:number,arg2:string):Promise<void>;
@@ -2,6 +2,10 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddTagAlias(arg1, arg2) {
+  return window['go']['main']['App']['AddTagAlias'](arg1, arg2);
+}
+
 export function AddTagToAsset(arg1, arg2) {
   return window['go']['main']['App']['AddTagToAsset'](arg1, arg2);
 }
@@ -14,6 +18,10 @@ export function AddWatchFolder() {
   return window['go']['main']['App']['AddWatchFolder']();
 }
 
+export function BackupLibrary(arg1) {
+  return window['go']['main']['App']['BackupLibrary'](arg1);
+}
+
 export function BulkAddToCollection(arg1, arg2) {
   return window['go']['main']['App']['BulkAddToCollection'](arg1, arg2);
 }
@@ -38,6 +46,10 @@ export function CreateCollection(arg1, arg2) {
   return window['go']['main']['App']['CreateCollection'](arg1, arg2);
 }
 
+export function CreateSmartCollection(arg1, arg2, arg3) {
+  return window['go']['main']['App']['CreateSmartCollection'](arg1, arg2, arg3);
+}
+
 export function DeleteAsset(arg1) {
   return window['go']['main']['App']['DeleteAsset'](arg1);
 }
@@ -46,6 +58,30 @@ export function DeleteCollection(arg1) {
   return window['go']['main']['App']['DeleteCollection'](arg1);
 }
 
+export function DeleteTag(arg1) {
+  return window['go']['main']['App']['DeleteTag'](arg1);
+}
+
+export function DeleteUnusedTags() {
+  return window['go']['main']['App']['DeleteUnusedTags']();
+}
+
+export function EmptyTrash() {
+  return window['go']['main']['App']['EmptyTrash']();
+}
+
+export function ExportLibrary(arg1) {
+  return window['go']['main']['App']['ExportLibrary'](arg1);
+}
+
+export function FilterAssets(arg1, arg2) {
+  return window['go']['main']['App']['FilterAssets'](arg1, arg2);
+}
+
+export function FindDuplicates() {
+  return window['go']['main']['App']['FindDuplicates']();
+}
+
 export function GetAllTags() {
   return window['go']['main']['App']['GetAllTags']();
 }
@@ -54,6 +90,10 @@ export function GetAssetIDsByTags(arg1) {
   return window['go']['main']['App']['GetAssetIDsByTags'](arg1);
 }
 
+export function GetAssetPreviews(arg1) {
+  return window['go']['main']['App']['GetAssetPreviews'](arg1);
+}
+
 export function GetAssets() {
   return window['go']['main']['App']['GetAssets']();
 }
@@ -62,6 +102,10 @@ export function GetAssetsByTag(arg1) {
   return window['go']['main']['App']['GetAssetsByTag'](arg1);
 }
 
+export function GetAssetsByTagSets(arg1, arg2, arg3, arg4, arg5, arg6) {
+  return window['go']['main']['App']['GetAssetsByTagSets'](arg1, arg2, arg3, arg4, arg5, arg6);
+}
+
 export function GetAssetsByTags(arg1) {
   return window['go']['main']['App']['GetAssetsByTags'](arg1);
 }
@@ -82,10 +126,18 @@ export function GetFavoritedAssets() {
   return window['go']['main']['App']['GetFavoritedAssets']();
 }
 
+export function GetFileServerToken() {
+  return window['go']['main']['App']['GetFileServerToken']();
+}
+
 export function GetFileServerURL() {
   return window['go']['main']['App']['GetFileServerURL']();
 }
 
+export function GetPreviewSettings() {
+  return window['go']['main']['App']['GetPreviewSettings']();
+}
+
 export function GetRecentlyAddedAssets() {
   return window['go']['main']['App']['GetRecentlyAddedAssets']();
 }
@@ -94,6 +146,14 @@ export function GetRecentlyUsedAssets() {
   return window['go']['main']['App']['GetRecentlyUsedAssets']();
 }
 
+export function GetTagAliases() {
+  return window['go']['main']['App']['GetTagAliases']();
+}
+
+export function GetTagTree() {
+  return window['go']['main']['App']['GetTagTree']();
+}
+
 export function GetTagsForAsset(arg1) {
   return window['go']['main']['App']['GetTagsForAsset'](arg1);
 }
@@ -106,6 +166,10 @@ export function GetThumbnail(arg1) {
   return window['go']['main']['App']['GetThumbnail'](arg1);
 }
 
+export function GetThumbnailRenderer() {
+  return window['go']['main']['App']['GetThumbnailRenderer']();
+}
+
 export function GetUntaggedAssets() {
   return window['go']['main']['App']['GetUntaggedAssets']();
 }
@@ -114,10 +178,22 @@ export function GetWatchFolders() {
   return window['go']['main']['App']['GetWatchFolders']();
 }
 
+export function ImportLibrary(arg1) {
+  return window['go']['main']['App']['ImportLibrary'](arg1);
+}
+
+export function ListAssetsPage(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['ListAssetsPage'](arg1, arg2, arg3, arg4);
+}
+
 export function MarkAssetUsed(arg1) {
   return window['go']['main']['App']['MarkAssetUsed'](arg1);
 }
 
+export function MergeTags(arg1, arg2) {
+  return window['go']['main']['App']['MergeTags'](arg1, arg2);
+}
+
 export function OpenFileInFolder(arg1) {
   return window['go']['main']['App']['OpenFileInFolder'](arg1);
 }
@@ -126,10 +202,26 @@ export function PingBlender() {
   return window['go']['main']['App']['PingBlender']();
 }
 
+export function QueryAssets(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['QueryAssets'](arg1, arg2, arg3, arg4);
+}
+
+export function Redo() {
+  return window['go']['main']['App']['Redo']();
+}
+
+export function RelocateWatchFolder(arg1, arg2) {
+  return window['go']['main']['App']['RelocateWatchFolder'](arg1, arg2);
+}
+
 export function RemoveFromCollection(arg1, arg2) {
   return window['go']['main']['App']['RemoveFromCollection'](arg1, arg2);
 }
 
+export function RemoveTagAlias(arg1) {
+  return window['go']['main']['App']['RemoveTagAlias'](arg1);
+}
+
 export function RemoveTagFromAsset(arg1, arg2) {
   return window['go']['main']['App']['RemoveTagFromAsset'](arg1, arg2);
 }
@@ -142,10 +234,26 @@ export function RenameCollection(arg1, arg2) {
   return window['go']['main']['App']['RenameCollection'](arg1, arg2);
 }
 
+export function RenameTag(arg1, arg2) {
+  return window['go']['main']['App']['RenameTag'](arg1, arg2);
+}
+
+export function RenderThumbnailsInBackground() {
+  return window['go']['main']['App']['RenderThumbnailsInBackground']();
+}
+
 export function RescanFolder(arg1) {
   return window['go']['main']['App']['RescanFolder'](arg1);
 }
 
+export function ResolveDuplicates(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ResolveDuplicates'](arg1, arg2, arg3);
+}
+
+export function RestoreAssets(arg1) {
+  return window['go']['main']['App']['RestoreAssets'](arg1);
+}
+
 export function SavePolyCount(arg1, arg2) {
   return window['go']['main']['App']['SavePolyCount'](arg1, arg2);
 }
@@ -154,10 +262,30 @@ export function SaveThumbnail(arg1, arg2) {
   return window['go']['main']['App']['SaveThumbnail'](arg1, arg2);
 }
 
+export function SearchAssets(arg1) {
+  return window['go']['main']['App']['SearchAssets'](arg1);
+}
+
 export function SendToBlender(arg1) {
   return window['go']['main']['App']['SendToBlender'](arg1);
 }
 
+export function SetPreviewSettings(arg1) {
+  return window['go']['main']['App']['SetPreviewSettings'](arg1);
+}
+
+export function SetThumbnailRenderer(arg1) {
+  return window['go']['main']['App']['SetThumbnailRenderer'](arg1);
+}
+
 export function ToggleFavorite(arg1) {
   return window['go']['main']['App']['ToggleFavorite'](arg1);
 }
+
+export function Undo() {
+  return window['go']['main']['App']['Undo']();
+}
+
+export function UpdateSmartCollection(arg1, arg2) {
+  return window['go']['main']['App']['UpdateSmartCollection'](arg1, arg2);
+}
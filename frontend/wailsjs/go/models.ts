@@ -3,6 +3,7 @@ export namespace main {
 	export class Asset {
 	    id: number;
 	    absolute_path: string;
+	    relative_path: string;
 	    filename: string;
 	    folder_id: number;
 	    file_size: number;
@@ -11,8 +12,23 @@ export namespace main {
 	    favorited: number;
 	    last_used_at: string;
 	    poly_count: number;
+	    vertex_count: number;
+	    mesh_count: number;
+	    material_count: number;
+	    texture_count: number;
+	    animation_count: number;
+	    skin_count: number;
+	    node_count: number;
+	    bounds_x: number;
+	    bounds_y: number;
+	    bounds_z: number;
+	    generator: string;
+	    copyright: string;
+	    extensions_used: string;
 	    created_at: string;
 	    updated_at: string;
+	    trashed_at: string;
+	    offline: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new Asset(source);
@@ -22,6 +38,7 @@ export namespace main {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
 	        this.absolute_path = source["absolute_path"];
+	        this.relative_path = source["relative_path"];
 	        this.filename = source["filename"];
 	        this.folder_id = source["folder_id"];
 	        this.file_size = source["file_size"];
@@ -30,8 +47,105 @@ export namespace main {
 	        this.favorited = source["favorited"];
 	        this.last_used_at = source["last_used_at"];
 	        this.poly_count = source["poly_count"];
+	        this.vertex_count = source["vertex_count"];
+	        this.mesh_count = source["mesh_count"];
+	        this.material_count = source["material_count"];
+	        this.texture_count = source["texture_count"];
+	        this.animation_count = source["animation_count"];
+	        this.skin_count = source["skin_count"];
+	        this.node_count = source["node_count"];
+	        this.bounds_x = source["bounds_x"];
+	        this.bounds_y = source["bounds_y"];
+	        this.bounds_z = source["bounds_z"];
+	        this.generator = source["generator"];
+	        this.copyright = source["copyright"];
+	        this.extensions_used = source["extensions_used"];
 	        this.created_at = source["created_at"];
 	        this.updated_at = source["updated_at"];
+	        this.trashed_at = source["trashed_at"];
+	        this.offline = source["offline"];
+	    }
+	}
+	export class AssetFilter {
+	    all_tags: string[];
+	    any_tags: string[];
+	    no_tags: string[];
+	    collection_id: number;
+	    folder: string;
+	    favorited: boolean;
+	    untagged: boolean;
+	    used_since: string;
+	    text: string;
+	    trashed: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new AssetFilter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.all_tags = source["all_tags"];
+	        this.any_tags = source["any_tags"];
+	        this.no_tags = source["no_tags"];
+	        this.collection_id = source["collection_id"];
+	        this.folder = source["folder"];
+	        this.favorited = source["favorited"];
+	        this.untagged = source["untagged"];
+	        this.used_since = source["used_since"];
+	        this.text = source["text"];
+	        this.trashed = source["trashed"];
+	    }
+	}
+	export class AssetPage {
+	    assets: Asset[];
+	    total: number;
+	    next_cursor: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AssetPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.assets = this.convertValues(source["assets"], Asset);
+	        this.total = source["total"];
+	        this.next_cursor = source["next_cursor"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class AssetPreviews {
+	    asset_id: number;
+	    turntable: string;
+	    frames: number;
+	    views: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AssetPreviews(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.asset_id = source["asset_id"];
+	        this.turntable = source["turntable"];
+	        this.frames = source["frames"];
+	        this.views = source["views"];
 	    }
 	}
 	export class BlenderStatus {
@@ -53,6 +167,8 @@ export namespace main {
 	    name: string;
 	    description: string;
 	    icon: string;
+	    kind: string;
+	    query: string;
 	    asset_count: number;
 	    created_at: string;
 	
@@ -66,10 +182,74 @@ export namespace main {
 	        this.name = source["name"];
 	        this.description = source["description"];
 	        this.icon = source["icon"];
+	        this.kind = source["kind"];
+	        this.query = source["query"];
 	        this.asset_count = source["asset_count"];
 	        this.created_at = source["created_at"];
 	    }
 	}
+	export class DuplicateGroup {
+	    content_hash: string;
+	    file_size: number;
+	    assets: Asset[];
+	
+	    static createFrom(source: any = {}) {
+	        return new DuplicateGroup(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.content_hash = source["content_hash"];
+	        this.file_size = source["file_size"];
+	        this.assets = this.convertValues(source["assets"], Asset);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ImportSummary {
+	    matched: number;
+	    unmatched: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.matched = source["matched"];
+	        this.unmatched = source["unmatched"];
+	    }
+	}
+	export class PreviewSettings {
+	    enabled: boolean;
+	    frames: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PreviewSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.frames = source["frames"];
+	    }
+	}
 	export class Tag {
 	    id: number;
 	    name: string;
@@ -84,9 +264,64 @@ export namespace main {
 	        this.name = source["name"];
 	    }
 	}
+	export class TagAlias {
+	    alias: string;
+	    tag_id: number;
+	    tag_name: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TagAlias(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.alias = source["alias"];
+	        this.tag_id = source["tag_id"];
+	        this.tag_name = source["tag_name"];
+	    }
+	}
+	export class TagNode {
+	    id: number;
+	    name: string;
+	    label: string;
+	    count: number;
+	    children: TagNode[];
+	
+	    static createFrom(source: any = {}) {
+	        return new TagNode(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.label = source["label"];
+	        this.count = source["count"];
+	        this.children = this.convertValues(source["children"], TagNode);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class TagWithCount {
 	    id: number;
 	    name: string;
+	    parent_id: number;
 	    count: number;
 	
 	    static createFrom(source: any = {}) {
@@ -97,6 +332,7 @@ export namespace main {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
 	        this.name = source["name"];
+	        this.parent_id = source["parent_id"];
 	        this.count = source["count"];
 	    }
 	}
@@ -104,6 +340,7 @@ export namespace main {
 	    id: number;
 	    path: string;
 	    created_at: string;
+	    offline_since: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new WatchFolder(source);
@@ -114,6 +351,7 @@ export namespace main {
 	        this.id = source["id"];
 	        this.path = source["path"];
 	        this.created_at = source["created_at"];
+	        this.offline_since = source["offline_since"];
 	    }
 	}
 
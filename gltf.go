@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gltfMetadataVersion is bumped whenever ParseGLTFFile starts extracting something
+// new, so existing assets get re-parsed on the next scan.
+const gltfMetadataVersion = 2
+
+// ModelInfo is the metadata extracted from a model file without rendering it.
+type ModelInfo struct {
+	TriangleCount  int64
+	VertexCount    int64
+	MeshCount      int64
+	MaterialCount  int64
+	TextureCount   int64
+	AnimationCount int64
+	SkinCount      int64
+	NodeCount      int64
+	// Bounds is the size of the scene's world-space bounding box (X, Y, Z).
+	Bounds         [3]float64
+	Generator      string
+	Copyright      string
+	ExtensionsUsed []string
+	// Names are the distinct node, mesh and material names, for search.
+	Names []string
+}
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	// glbMaxJSONChunk guards against corrupt headers asking for absurd allocations.
+	glbMaxJSONChunk = 64 << 20
+)
+
+// glTF primitive modes that produce triangles.
+const (
+	gltfModeTriangles     = 4
+	gltfModeTriangleStrip = 5
+	gltfModeTriangleFan   = 6
+)
+
+// gltfDocument is the subset of the glTF 2.0 JSON schema needed for metadata.
+type gltfDocument struct {
+	Asset struct {
+		Generator string `json:"generator"`
+		Copyright string `json:"copyright"`
+		Version   string `json:"version"`
+	} `json:"asset"`
+	ExtensionsUsed []string `json:"extensionsUsed"`
+	Scene          *int     `json:"scene"`
+	Scenes         []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Name        string    `json:"name"`
+		Children    []int     `json:"children"`
+		Mesh        *int      `json:"mesh"`
+		Matrix      []float64 `json:"matrix"`
+		Translation []float64 `json:"translation"`
+		Rotation    []float64 `json:"rotation"`
+		Scale       []float64 `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Name       string `json:"name"`
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		Count int64     `json:"count"`
+		Min   []float64 `json:"min"`
+		Max   []float64 `json:"max"`
+	} `json:"accessors"`
+	Materials []struct {
+		Name string `json:"name"`
+	} `json:"materials"`
+	Textures   []json.RawMessage `json:"textures"`
+	Animations []json.RawMessage `json:"animations"`
+	Skins      []json.RawMessage `json:"skins"`
+}
+
+// ParseGLTFFile reads a .glb or .gltf file and extracts its ModelInfo. Only the
+// JSON part of the file is read; geometry buffers are never loaded.
+func ParseGLTFFile(path string) (*ModelInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var raw []byte
+	if strings.ToLower(filepath.Ext(path)) == ".glb" {
+		raw, err = readGLBJSON(f)
+	} else {
+		raw, err = io.ReadAll(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc gltfDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse gltf json: %w", err)
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2") {
+		return nil, fmt.Errorf("unsupported gltf version %q", doc.Asset.Version)
+	}
+	return doc.modelInfo(), nil
+}
+
+// readGLBJSON returns the JSON chunk of a binary glTF container.
+func readGLBJSON(r io.Reader) ([]byte, error) {
+	var header [5]uint32 // magic, version, length, chunk length, chunk type
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("read glb header: %w", err)
+	}
+	if header[0] != glbMagic {
+		return nil, errors.New("not a glb file")
+	}
+	if header[1] != 2 {
+		return nil, fmt.Errorf("unsupported glb version %d", header[1])
+	}
+	if header[4] != glbChunkJSON {
+		return nil, errors.New("glb first chunk is not JSON")
+	}
+	if header[3] > glbMaxJSONChunk {
+		return nil, fmt.Errorf("glb JSON chunk too large (%d bytes)", header[3])
+	}
+	buf := make([]byte, header[3])
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("read glb json chunk: %w", err)
+	}
+	return buf, nil
+}
+
+func (doc *gltfDocument) modelInfo() *ModelInfo {
+	info := &ModelInfo{
+		MeshCount:      int64(len(doc.Meshes)),
+		MaterialCount:  int64(len(doc.Materials)),
+		TextureCount:   int64(len(doc.Textures)),
+		AnimationCount: int64(len(doc.Animations)),
+		SkinCount:      int64(len(doc.Skins)),
+		NodeCount:      int64(len(doc.Nodes)),
+		Generator:      doc.Asset.Generator,
+		Copyright:      doc.Asset.Copyright,
+		ExtensionsUsed: doc.ExtensionsUsed,
+	}
+
+	bounds := newBounds()
+	instanced := false
+
+	// Walk the scene graph so that meshes used by several nodes count once per
+	// instance and bounds are measured in world space.
+	var visit func(node int, parent mat4, depth int)
+	visit = func(node int, parent mat4, depth int) {
+		if node < 0 || node >= len(doc.Nodes) || depth > len(doc.Nodes) {
+			return
+		}
+		n := doc.Nodes[node]
+		world := parent.mul(nodeMatrix(n.Matrix, n.Translation, n.Rotation, n.Scale))
+		if n.Mesh != nil {
+			instanced = true
+			doc.addMesh(info, &bounds, *n.Mesh, world)
+		}
+		for _, c := range n.Children {
+			visit(c, world, depth+1)
+		}
+	}
+	for _, root := range doc.sceneRoots() {
+		visit(root, identity(), 0)
+	}
+
+	// No scene graph — fall back to counting each mesh once, untransformed.
+	if !instanced {
+		for i := range doc.Meshes {
+			doc.addMesh(info, &bounds, i, identity())
+		}
+	}
+
+	info.Bounds = bounds.size()
+	info.Names = doc.names()
+	return info
+}
+
+// names returns the distinct non-empty node, mesh and material names in document order.
+func (doc *gltfDocument) names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, n := range doc.Nodes {
+		add(n.Name)
+	}
+	for _, m := range doc.Meshes {
+		add(m.Name)
+	}
+	for _, m := range doc.Materials {
+		add(m.Name)
+	}
+	return names
+}
+
+// sceneRoots returns the root nodes of the default scene, or of every node if there are no scenes.
+func (doc *gltfDocument) sceneRoots() []int {
+	if len(doc.Scenes) > 0 {
+		s := 0
+		if doc.Scene != nil && *doc.Scene >= 0 && *doc.Scene < len(doc.Scenes) {
+			s = *doc.Scene
+		}
+		return doc.Scenes[s].Nodes
+	}
+	// Roots are the nodes nobody lists as a child
+	isChild := make([]bool, len(doc.Nodes))
+	for _, n := range doc.Nodes {
+		for _, c := range n.Children {
+			if c >= 0 && c < len(isChild) {
+				isChild[c] = true
+			}
+		}
+	}
+	var roots []int
+	for i, child := range isChild {
+		if !child {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
+
+func (doc *gltfDocument) addMesh(info *ModelInfo, b *bounds, mesh int, world mat4) {
+	if mesh < 0 || mesh >= len(doc.Meshes) {
+		return
+	}
+	for _, p := range doc.Meshes[mesh].Primitives {
+		pos, ok := p.Attributes["POSITION"]
+		if !ok || pos < 0 || pos >= len(doc.Accessors) {
+			continue
+		}
+		posAcc := doc.Accessors[pos]
+		info.VertexCount += posAcc.Count
+
+		count := posAcc.Count
+		if p.Indices != nil && *p.Indices >= 0 && *p.Indices < len(doc.Accessors) {
+			count = doc.Accessors[*p.Indices].Count
+		}
+		mode := gltfModeTriangles
+		if p.Mode != nil {
+			mode = *p.Mode
+		}
+		switch mode {
+		case gltfModeTriangles:
+			info.TriangleCount += count / 3
+		case gltfModeTriangleStrip, gltfModeTriangleFan:
+			if count > 2 {
+				info.TriangleCount += count - 2
+			}
+		}
+
+		// POSITION accessors are required to carry min/max
+		if len(posAcc.Min) == 3 && len(posAcc.Max) == 3 {
+			b.addBox(posAcc.Min, posAcc.Max, world)
+		}
+	}
+}
+
+// --- Minimal 3D math for bounds ---
+
+// mat4 is a column-major 4x4 matrix, matching glTF's layout.
+type mat4 [16]float64
+
+func identity() mat4 {
+	return mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+func (a mat4) mul(b mat4) mat4 {
+	var m mat4
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += a[k*4+row] * b[col*4+k]
+			}
+			m[col*4+row] = sum
+		}
+	}
+	return m
+}
+
+func (m mat4) transformPoint(x, y, z float64) (float64, float64, float64) {
+	return m[0]*x + m[4]*y + m[8]*z + m[12],
+		m[1]*x + m[5]*y + m[9]*z + m[13],
+		m[2]*x + m[6]*y + m[10]*z + m[14]
+}
+
+// nodeMatrix builds a node's local transform from either its matrix or its TRS properties.
+func nodeMatrix(matrix, t, r, s []float64) mat4 {
+	if len(matrix) == 16 {
+		var m mat4
+		copy(m[:], matrix)
+		return m
+	}
+	tx, ty, tz := 0.0, 0.0, 0.0
+	if len(t) == 3 {
+		tx, ty, tz = t[0], t[1], t[2]
+	}
+	qx, qy, qz, qw := 0.0, 0.0, 0.0, 1.0
+	if len(r) == 4 {
+		qx, qy, qz, qw = r[0], r[1], r[2], r[3]
+	}
+	sx, sy, sz := 1.0, 1.0, 1.0
+	if len(s) == 3 {
+		sx, sy, sz = s[0], s[1], s[2]
+	}
+
+	// T * R * S
+	return mat4{
+		(1 - 2*(qy*qy+qz*qz)) * sx, (2 * (qx*qy + qz*qw)) * sx, (2 * (qx*qz - qy*qw)) * sx, 0,
+		(2 * (qx*qy - qz*qw)) * sy, (1 - 2*(qx*qx+qz*qz)) * sy, (2 * (qy*qz + qx*qw)) * sy, 0,
+		(2 * (qx*qz + qy*qw)) * sz, (2 * (qy*qz - qx*qw)) * sz, (1 - 2*(qx*qx+qy*qy)) * sz, 0,
+		tx, ty, tz, 1,
+	}
+}
+
+type bounds struct {
+	min, max [3]float64
+}
+
+func newBounds() bounds {
+	return bounds{
+		min: [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)},
+		max: [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
+	}
+}
+
+func (b *bounds) valid() bool {
+	return b.min[0] <= b.max[0]
+}
+
+// size returns the extent along each axis, or zeros if nothing was added.
+func (b *bounds) size() [3]float64 {
+	var s [3]float64
+	if b.valid() {
+		for i := 0; i < 3; i++ {
+			s[i] = b.max[i] - b.min[i]
+		}
+	}
+	return s
+}
+
+func (b *bounds) addPoint(x, y, z float64) {
+	p := [3]float64{x, y, z}
+	for i := 0; i < 3; i++ {
+		b.min[i] = math.Min(b.min[i], p[i])
+		b.max[i] = math.Max(b.max[i], p[i])
+	}
+}
+
+// addBox transforms the eight corners of a local-space box and adds them.
+func (b *bounds) addBox(lo, hi []float64, m mat4) {
+	for i := 0; i < 8; i++ {
+		x, y, z := lo[0], lo[1], lo[2]
+		if i&1 != 0 {
+			x = hi[0]
+		}
+		if i&2 != 0 {
+			y = hi[1]
+		}
+		if i&4 != 0 {
+			z = hi[2]
+		}
+		b.addPoint(m.transformPoint(x, y, z))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFixture writes data to a file named name in a temporary directory.
+func writeFixture(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFixture returns the contents of a file in testdata.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// glbFile wraps glTF JSON in a binary container.
+func glbFile(magic, version uint32, jsonChunk []byte) []byte {
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{magic, version, uint32(20 + len(jsonChunk)), uint32(len(jsonChunk)), glbChunkJSON})
+	buf.Write(jsonChunk)
+	return buf.Bytes()
+}
+
+func TestParseGLTFFile(t *testing.T) {
+	want := &ModelInfo{
+		// CubeA and CubeB instance the mesh; Unused isn't in the scene
+		TriangleCount:  24,
+		VertexCount:    48,
+		MeshCount:      1,
+		MaterialCount:  1,
+		TextureCount:   1,
+		NodeCount:      4,
+		Bounds:         [3]float64{5, 2, 2},
+		Generator:      "Sushi fixtures",
+		Copyright:      "CC0",
+		ExtensionsUsed: []string{"KHR_materials_unlit"},
+		Names:          []string{"Root", "CubeA", "CubeB", "Unused", "Cube", "Wood"},
+	}
+	doc := readFixture(t, "cube.gltf")
+	for _, path := range []string{
+		filepath.Join("testdata", "cube.gltf"),
+		writeFixture(t, "cube.glb", glbFile(glbMagic, 2, doc)),
+	} {
+		info, err := ParseGLTFFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+			continue
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", filepath.Base(path), info, want)
+		}
+	}
+}
+
+func TestParseGLTFFileWithoutScenes(t *testing.T) {
+	// Without scenes every node nobody parents is a root, and the matrix and
+	// TRS transforms both apply
+	path := writeFixture(t, "loose.gltf", []byte(`{
+		"asset": {"version": "2.0"},
+		"nodes": [
+			{"children": [1], "scale": [2, 2, 2]},
+			{"mesh": 0, "matrix": [1,0,0,0, 0,1,0,0, 0,0,1,0, 0,5,0,1]}
+		],
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "mode": 5}]}],
+		"accessors": [{"count": 6, "min": [0, 0, 0], "max": [1, 1, 1]}]
+	}`))
+	info, err := ParseGLTFFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.TriangleCount != 4 || info.VertexCount != 6 || info.Bounds != [3]float64{2, 2, 2} {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func TestParseGLTFFileErrors(t *testing.T) {
+	doc := readFixture(t, "cube.gltf")
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"old.gltf", []byte(`{"asset": {"version": "1.0"}}`), `unsupported gltf version "1.0"`},
+		{"broken.gltf", []byte(`{"asset": `), "parse gltf json"},
+		{"magic.glb", glbFile(0x12345678, 2, doc), "not a glb file"},
+		{"v1.glb", glbFile(glbMagic, 1, doc), "unsupported glb version 1"},
+		{"short.glb", []byte("glTF"), "read glb header"},
+		{"truncated.glb", glbFile(glbMagic, 2, doc)[:100], "read glb json chunk"},
+	}
+	for _, tt := range tests {
+		_, err := ParseGLTFFile(writeFixture(t, tt.name, tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
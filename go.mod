@@ -3,6 +3,7 @@ module sushi
 go 1.24.0
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/wailsapp/wails/v2 v2.11.0
 	modernc.org/sqlite v1.44.3
 )
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Library edits made through App — tagging, trays, favorites, renames and
+// deletes — are recorded in the journal so they can be undone and redone, even
+// after a restart. Each entry stores the operations that redo the edit and the
+// ones that undo it. Undoing an entry marks it undone; recording a new edit
+// discards the undone entries, as in any editor.
+
+// journalLimit is how many edits the journal keeps.
+const journalLimit = 200
+
+// Journal operation kinds. Every operation is idempotent, so replaying one that
+// is already in effect changes nothing. An entry that fails part-way is dropped
+// from the journal rather than tried again.
+const (
+	opTag              = "tag"
+	opUntag            = "untag"
+	opCollect          = "collect"
+	opUncollect        = "uncollect"
+	opFavorite         = "favorite"
+	opRenameTag        = "rename-tag"
+	opRenameCollection = "rename-collection"
+	opTrash            = "trash"
+	opRestore          = "restore"
+)
+
+// journalOp is one primitive change to the library.
+type journalOp struct {
+	Kind     string  `json:"kind"`
+	AssetIDs []int64 `json:"asset_ids,omitempty"`
+	// ID is the tag or collection the operation applies to.
+	ID int64 `json:"id,omitempty"`
+	// Name is the tag name for opTag, so a tag deleted in the meantime can be
+	// recreated, and the new name for renames.
+	Name      string `json:"name,omitempty"`
+	Favorited bool   `json:"favorited,omitempty"`
+}
+
+// journalEntry is one recorded edit.
+type journalEntry struct {
+	id    int64
+	label string
+	redo  []journalOp
+	undo  []journalOp
+}
+
+// RecordEdit adds an edit to the journal, dropping any undone edits and the
+// oldest ones beyond journalLimit.
+func (d *Database) RecordEdit(label string, redo, undo []journalOp) error {
+	redoJSON, err := json.Marshal(redo)
+	if err != nil {
+		return err
+	}
+	undoJSON, err := json.Marshal(undo)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM journal WHERE undone = 1"); err != nil {
+		return err
+	}
+	nowStr := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.Exec("INSERT INTO journal (label, redo, undo, created_at) VALUES (?, ?, ?, ?)", label, string(redoJSON), string(undoJSON), nowStr); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM journal WHERE id NOT IN (SELECT id FROM journal ORDER BY id DESC LIMIT ?)", journalLimit); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nextJournalEntry returns the edit Undo would revert, or with redo set, the one
+// Redo would reapply. It returns nil when there is none.
+func (d *Database) nextJournalEntry(redo bool) (*journalEntry, error) {
+	query := "SELECT id, label, redo, undo FROM journal WHERE undone = 0 ORDER BY id DESC LIMIT 1"
+	if redo {
+		query = "SELECT id, label, redo, undo FROM journal WHERE undone = 1 ORDER BY id ASC LIMIT 1"
+	}
+	var e journalEntry
+	var redoJSON, undoJSON string
+	err := d.db.QueryRow(query).Scan(&e.id, &e.label, &redoJSON, &undoJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(redoJSON), &e.redo); err != nil {
+		return nil, fmt.Errorf("journal entry %d: %w", e.id, err)
+	}
+	if err := json.Unmarshal([]byte(undoJSON), &e.undo); err != nil {
+		return nil, fmt.Errorf("journal entry %d: %w", e.id, err)
+	}
+	return &e, nil
+}
+
+// setJournalUndone marks an edit as undone or back in effect.
+func (d *Database) setJournalUndone(id int64, undone bool) error {
+	_, err := d.db.Exec("UPDATE journal SET undone = ? WHERE id = ?", undone, id)
+	return err
+}
+
+// deleteJournalEntry drops an edit from the journal.
+func (d *Database) deleteJournalEntry(id int64) error {
+	_, err := d.db.Exec("DELETE FROM journal WHERE id = ?", id)
+	return err
+}
+
+// assetIDsWhere returns those of ids whose asset, aliased as a, matches cond.
+func (d *Database) assetIDsWhere(ids []int64, cond string, args ...interface{}) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	all := append([]interface{}{}, args...)
+	for _, id := range ids {
+		all = append(all, id)
+	}
+	rows, err := d.db.Query("SELECT a.id FROM assets a WHERE ("+cond+") AND a.id IN ("+placeholders(len(ids))+") ORDER BY a.id", all...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matched []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		matched = append(matched, id)
+	}
+	return matched, rows.Err()
+}
+
+// PruneJournal drops or trims the edits that deleting assets, tags or trays has
+// made impossible to undo or redo. Operations lose the assets that are gone, and
+// an edit goes entirely once any of its operations has nothing left to apply to.
+func (d *Database) PruneJournal() error {
+	rows, err := d.db.Query("SELECT id, redo, undo FROM journal")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type stored struct {
+		id         int64
+		redo, undo []journalOp
+	}
+	var entries []stored
+	assets, tags, collections := map[int64]bool{}, map[int64]bool{}, map[int64]bool{}
+	for rows.Next() {
+		var e stored
+		var redoJSON, undoJSON string
+		if err := rows.Scan(&e.id, &redoJSON, &undoJSON); err != nil {
+			return err
+		}
+		if json.Unmarshal([]byte(redoJSON), &e.redo) != nil || json.Unmarshal([]byte(undoJSON), &e.undo) != nil {
+			e.redo, e.undo = nil, nil // unreadable, so dropped below
+		}
+		for _, op := range append(append([]journalOp{}, e.redo...), e.undo...) {
+			for _, id := range op.AssetIDs {
+				assets[id] = false
+			}
+			switch op.Kind {
+			case opTag, opUntag, opRenameTag:
+				tags[op.ID] = false
+			case opCollect, opUncollect, opRenameCollection:
+				collections[op.ID] = false
+			}
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for table, ids := range map[string]map[int64]bool{"assets": assets, "tags": tags, "collections": collections} {
+		if err := d.markExisting(table, ids); err != nil {
+			return err
+		}
+	}
+
+	// prune trims ops to existing assets, reporting whether they can all still
+	// be applied and whether any changed.
+	prune := func(ops []journalOp) (live, changed bool) {
+		for i, op := range ops {
+			switch op.Kind {
+			case opTag, opUntag, opRenameTag:
+				if !tags[op.ID] {
+					return false, true
+				}
+			case opCollect, opUncollect, opRenameCollection:
+				if !collections[op.ID] {
+					return false, true
+				}
+			}
+			if len(op.AssetIDs) == 0 {
+				continue
+			}
+			var kept []int64
+			for _, id := range op.AssetIDs {
+				if assets[id] {
+					kept = append(kept, id)
+				}
+			}
+			if len(kept) == 0 {
+				return false, true
+			}
+			if len(kept) < len(op.AssetIDs) {
+				ops[i].AssetIDs = kept
+				changed = true
+			}
+		}
+		return len(ops) > 0, changed
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, e := range entries {
+		redoLive, redoChanged := prune(e.redo)
+		undoLive, undoChanged := prune(e.undo)
+		switch {
+		case !redoLive || !undoLive:
+			if _, err := tx.Exec("DELETE FROM journal WHERE id = ?", e.id); err != nil {
+				return err
+			}
+		case redoChanged || undoChanged:
+			redoJSON, err := json.Marshal(e.redo)
+			if err != nil {
+				return err
+			}
+			undoJSON, err := json.Marshal(e.undo)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE journal SET redo = ?, undo = ? WHERE id = ?", string(redoJSON), string(undoJSON), e.id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// markExisting sets ids[id] for each id that still has a row in table.
+func (d *Database) markExisting(table string, ids map[int64]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for id := range ids {
+		args = append(args, id)
+	}
+	rows, err := d.db.Query("SELECT id FROM "+table+" WHERE id IN ("+placeholders(len(args))+")", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids[id] = true
+	}
+	return rows.Err()
+}
+
+// --- Recording ---
+
+// record journals an edit. The edit has already happened, so a failure to record
+// it is only logged.
+func (a *App) record(label string, redo, undo []journalOp) {
+	if err := a.db.RecordEdit(label, redo, undo); err != nil {
+		fmt.Printf("[journal] warn: record %q: %v\n", label, err)
+	}
+}
+
+// pruneJournal drops the edits an irreversible change, like deleting a tag or
+// emptying the trash, has invalidated. The change has already happened, so a
+// failure is only logged.
+func (a *App) pruneJournal() {
+	if err := a.db.PruneJournal(); err != nil {
+		fmt.Printf("[journal] warn: prune: %v\n", err)
+	}
+}
+
+// tagAssets tags assets, journaling the assets that didn't have the tag yet.
+func (a *App) tagAssets(assetIDs []int64, tagName string) (*Tag, error) {
+	tag, err := a.db.CreateTag(tagName)
+	if err != nil {
+		return nil, err
+	}
+	added, err := a.db.assetIDsWhere(assetIDs, "NOT EXISTS (SELECT 1 FROM asset_tags WHERE asset_id = a.id AND tag_id = ?)", tag.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.db.BulkTagAssets(added, tag.Name); err != nil {
+		return nil, err
+	}
+	if len(added) > 0 {
+		a.record(fmt.Sprintf("Tag %s #%s", countAssets(len(added)), tag.Name),
+			[]journalOp{{Kind: opTag, AssetIDs: added, ID: tag.ID, Name: tag.Name}},
+			[]journalOp{{Kind: opUntag, AssetIDs: added, ID: tag.ID}})
+	}
+	return tag, nil
+}
+
+// collectAssets adds assets to a manual tray, journaling the ones that weren't
+// in it yet.
+func (a *App) collectAssets(collectionID int64, assetIDs []int64) error {
+	added, err := a.db.assetIDsWhere(assetIDs, "NOT EXISTS (SELECT 1 FROM collection_assets WHERE asset_id = a.id AND collection_id = ?)", collectionID)
+	if err != nil {
+		return err
+	}
+	if err := a.db.BulkAddToCollection(collectionID, added); err != nil {
+		return err
+	}
+	if len(added) > 0 {
+		a.record(fmt.Sprintf("Add %s to %s", countAssets(len(added)), a.collectionName(collectionID)),
+			[]journalOp{{Kind: opCollect, AssetIDs: added, ID: collectionID}},
+			[]journalOp{{Kind: opUncollect, AssetIDs: added, ID: collectionID}})
+	}
+	return nil
+}
+
+// setFavorite sets the favorite flag on assets, journaling the ones it changed.
+func (a *App) setFavorite(assetIDs []int64, favorited bool) error {
+	changed, err := a.db.assetIDsWhere(assetIDs, "a.favorited != ?", favorited)
+	if err != nil {
+		return err
+	}
+	if err := a.db.BulkSetFavorite(changed, favorited); err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		verb := "Favorite"
+		if !favorited {
+			verb = "Unfavorite"
+		}
+		a.record(fmt.Sprintf("%s %s", verb, countAssets(len(changed))),
+			[]journalOp{{Kind: opFavorite, AssetIDs: changed, Favorited: favorited}},
+			[]journalOp{{Kind: opFavorite, AssetIDs: changed, Favorited: !favorited}})
+	}
+	return nil
+}
+
+// untagAsset removes a tag from an asset, journaling it if the asset had it.
+func (a *App) untagAsset(assetID, tagID int64) error {
+	tag, err := a.db.GetTag(tagID)
+	if err != nil {
+		return err
+	}
+	had, err := a.db.assetIDsWhere([]int64{assetID}, "EXISTS (SELECT 1 FROM asset_tags WHERE asset_id = a.id AND tag_id = ?)", tagID)
+	if err != nil {
+		return err
+	}
+	if err := a.db.UntagAsset(assetID, tagID); err != nil {
+		return err
+	}
+	if len(had) > 0 {
+		a.record(fmt.Sprintf("Remove #%s from %s", tag.Name, countAssets(1)),
+			[]journalOp{{Kind: opUntag, AssetIDs: had, ID: tagID}},
+			[]journalOp{{Kind: opTag, AssetIDs: had, ID: tagID, Name: tag.Name}})
+	}
+	return nil
+}
+
+// uncollectAsset removes an asset from a manual tray, journaling it if the asset
+// was in it.
+func (a *App) uncollectAsset(collectionID, assetID int64) error {
+	had, err := a.db.assetIDsWhere([]int64{assetID}, "EXISTS (SELECT 1 FROM collection_assets WHERE asset_id = a.id AND collection_id = ?)", collectionID)
+	if err != nil {
+		return err
+	}
+	if err := a.db.RemoveAssetFromCollection(collectionID, assetID); err != nil {
+		return err
+	}
+	if len(had) > 0 {
+		a.record(fmt.Sprintf("Remove %s from %s", countAssets(1), a.collectionName(collectionID)),
+			[]journalOp{{Kind: opUncollect, AssetIDs: had, ID: collectionID}},
+			[]journalOp{{Kind: opCollect, AssetIDs: had, ID: collectionID}})
+	}
+	return nil
+}
+
+// renameTag renames a tag and journals the old name.
+func (a *App) renameTag(id int64, name string) error {
+	tag, err := a.db.GetTag(id)
+	if err != nil {
+		return err
+	}
+	if err := a.db.RenameTag(id, name); err != nil {
+		return err
+	}
+	renamed, err := a.db.GetTag(id)
+	if err != nil || renamed.Name == tag.Name {
+		return err
+	}
+	a.record(fmt.Sprintf("Rename #%s to #%s", tag.Name, renamed.Name),
+		[]journalOp{{Kind: opRenameTag, ID: id, Name: renamed.Name}},
+		[]journalOp{{Kind: opRenameTag, ID: id, Name: tag.Name}})
+	return nil
+}
+
+// renameCollection renames a tray and journals the old name.
+func (a *App) renameCollection(id int64, name string) error {
+	c, err := a.db.GetCollection(id)
+	if err != nil {
+		return err
+	}
+	if err := a.db.RenameCollection(id, name); err != nil {
+		return err
+	}
+	if name != c.Name {
+		a.record(fmt.Sprintf("Rename tray %q to %q", c.Name, name),
+			[]journalOp{{Kind: opRenameCollection, ID: id, Name: name}},
+			[]journalOp{{Kind: opRenameCollection, ID: id, Name: c.Name}})
+	}
+	return nil
+}
+
+// collectionName names a tray for journal labels.
+func (a *App) collectionName(id int64) string {
+	if c, err := a.db.GetCollection(id); err == nil {
+		return fmt.Sprintf("tray %q", c.Name)
+	}
+	return "tray"
+}
+
+// countAssets returns "an asset" or "N assets".
+func countAssets(n int) string {
+	if n == 1 {
+		return "an asset"
+	}
+	return fmt.Sprintf("%d assets", n)
+}
+
+// --- Replaying ---
+
+// applyOps performs journal operations in order, stopping at the first failure.
+func (a *App) applyOps(ops []journalOp) error {
+	for _, op := range ops {
+		if err := a.applyOp(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyOp performs one journal operation. Assets, tags and trays deleted since
+// it was recorded are skipped, since there is nothing left to change.
+func (a *App) applyOp(op journalOp) error {
+	ids, err := a.db.assetIDsWhere(op.AssetIDs, "1")
+	if err != nil {
+		return err
+	}
+	switch op.Kind {
+	case opTag:
+		// The tag may have been deleted since, e.g. as unused after an untag
+		tag, err := a.db.GetTag(op.ID)
+		if errors.Is(err, sql.ErrNoRows) && len(ids) > 0 {
+			tag, err = a.db.CreateTag(op.Name)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := a.db.TagAsset(id, tag.ID); err != nil {
+				return err
+			}
+		}
+	case opUntag:
+		for _, id := range ids {
+			if err := a.db.UntagAsset(id, op.ID); err != nil {
+				return err
+			}
+		}
+	case opCollect, opUncollect, opRenameCollection:
+		if _, err := a.db.GetCollection(op.ID); errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch op.Kind {
+		case opCollect:
+			return a.db.BulkAddToCollection(op.ID, ids)
+		case opUncollect:
+			for _, id := range ids {
+				if err := a.db.RemoveAssetFromCollection(op.ID, id); err != nil {
+					return err
+				}
+			}
+		default:
+			return a.db.RenameCollection(op.ID, op.Name)
+		}
+	case opFavorite:
+		return a.db.BulkSetFavorite(ids, op.Favorited)
+	case opRenameTag:
+		if _, err := a.db.GetTag(op.ID); errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return a.db.RenameTag(op.ID, op.Name)
+	case opTrash:
+		for _, id := range ids {
+			if err := a.trashAsset(id); err != nil {
+				return err
+			}
+		}
+	case opRestore:
+		for _, id := range ids {
+			if err := a.restoreAsset(id); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown journal operation %q", op.Kind)
+	}
+	return nil
+}
+
+// stepJournal undoes the latest edit, or with redo set, reapplies the earliest
+// undone one, returning its label ("" when there is nothing to do). An edit
+// that can't be applied any more is dropped from the journal, so the ones
+// before it can still be reached.
+func (a *App) stepJournal(redo bool) (string, error) {
+	e, err := a.db.nextJournalEntry(redo)
+	if err != nil || e == nil {
+		return "", err
+	}
+	ops, verb := e.undo, "undo"
+	if redo {
+		ops, verb = e.redo, "redo"
+	}
+	if err := a.applyOps(ops); err != nil {
+		if derr := a.db.deleteJournalEntry(e.id); derr != nil {
+			fmt.Printf("[journal] warn: drop %q: %v\n", e.label, derr)
+		}
+		return "", fmt.Errorf("can't %s %s, so it was dropped from the history: %w", verb, e.label, err)
+	}
+	if err := a.db.setJournalUndone(e.id, !redo); err != nil {
+		return "", err
+	}
+	return e.label, nil
+}
+
+func migrateJournal(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS journal (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			label      TEXT    NOT NULL,
+			redo       TEXT    NOT NULL,
+			undo       TEXT    NOT NULL,
+			undone     INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT    NOT NULL
+		);
+	`)
+	return err
+}
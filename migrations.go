@@ -0,0 +1,344 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// migration is one numbered step of the schema. Steps run in order, each in its
+// own transaction, and are recorded in schema_version once applied. Never edit a
+// released step — add a new one instead.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations returns the full schema history. Steps 1–5 are written to be idempotent
+// because they also bring databases from before schema_version existed up to date,
+// whatever mix of the old ad-hoc ALTERs they had already received.
+func (d *Database) migrations() []migration {
+	return []migration{
+		{1, "initial schema", migrateInitialSchema},
+		{2, "move detection and content hashes", migrateMoveDetection},
+		{3, "model metadata", migrateModelMetadata},
+		{4, "full-text search", migrateSearch},
+		{5, "smart collections", migrateSmartCollections},
+		{6, "thumbnails to files", d.migrateThumbnailFiles},
+		{7, "settings", migrateSettings},
+		{8, "asset previews", migrateAssetPreviews},
+		{9, "sort indexes", migrateSortIndexes},
+		{10, "tag hierarchy", migrateTagHierarchy},
+		{11, "tag aliases", migrateTagAliases},
+		{12, "recycle bin", migrateRecycleBin},
+		{13, "undo journal", migrateJournal},
+		{14, "folder-relative paths", migrateRelativePaths},
+		{15, "offline watch folders", migrateOfflineFolders},
+		{16, "watch folder devices", migrateFolderDevices},
+		{17, "asset devices", migrateAssetDevices},
+	}
+}
+
+func (d *Database) migrate() error {
+	if _, err := d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT    NOT NULL,
+			applied_at TEXT    NOT NULL DEFAULT (datetime('now'))
+		)
+	`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := d.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return err
+	}
+	migrations := d.migrations()
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema v%d is newer than this version of Sushi supports (v%d); please update the app", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	// Anything with tables already in it is worth keeping a copy of
+	var existing int
+	d.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'assets'").Scan(&existing)
+	if existing > 0 {
+		backup := fmt.Sprintf("%s.pre-v%d.bak", d.path, latest)
+		if err := d.backupTo(backup); err != nil {
+			return fmt.Errorf("backup before migrating: %w", err)
+		}
+		fmt.Printf("[db] backed up database to %s\n", backup)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		fmt.Printf("[db] migrating to v%d: %s\n", m.version, m.name)
+		if err := d.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	// Upgrades can free a lot of space (e.g. inline thumbnails moving out)
+	if existing > 0 {
+		if _, err := d.db.Exec("VACUUM"); err != nil {
+			fmt.Printf("[db] warn: vacuum after migrating: %v\n", err)
+		}
+	}
+	return nil
+}
+
+func (d *Database) applyMigration(m migration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := m.up(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// backupTo writes a consistent copy of the database to path, replacing any
+// earlier file there.
+func (d *Database) backupTo(path string) error {
+	os.Remove(path)
+	_, err := d.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// addColumn adds a column unless the table already has it.
+func addColumn(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, column) {
+			return nil
+		}
+	}
+	rows.Close()
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
+
+// addColumns adds each "name DECL" column to table if missing.
+func addColumns(tx *sql.Tx, table string, columns ...string) error {
+	for _, c := range columns {
+		name, decl, _ := strings.Cut(c, " ")
+		if err := addColumn(tx, table, name, decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS watch_folders (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		path       TEXT    NOT NULL UNIQUE,
+		created_at TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+
+	CREATE TABLE IF NOT EXISTS assets (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		absolute_path TEXT    NOT NULL UNIQUE,
+		filename      TEXT    NOT NULL,
+		folder_id     INTEGER NOT NULL REFERENCES watch_folders(id) ON DELETE CASCADE,
+		file_size     INTEGER NOT NULL,
+		modified_at   TEXT    NOT NULL,
+		thumbnail     TEXT    DEFAULT '',
+		favorited     INTEGER NOT NULL DEFAULT 0,
+		last_used_at  TEXT    DEFAULT '',
+		poly_count    INTEGER NOT NULL DEFAULT 0,
+		created_at    TEXT    NOT NULL DEFAULT (datetime('now')),
+		updated_at    TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_assets_folder   ON assets(folder_id);
+	CREATE INDEX IF NOT EXISTS idx_assets_filename  ON assets(filename);
+
+	CREATE TABLE IF NOT EXISTS tags (
+		id   INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT    NOT NULL UNIQUE
+	);
+
+	CREATE TABLE IF NOT EXISTS asset_tags (
+		asset_id INTEGER NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+		tag_id   INTEGER NOT NULL REFERENCES tags(id)   ON DELETE CASCADE,
+		PRIMARY KEY (asset_id, tag_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS collections (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		name        TEXT    NOT NULL UNIQUE,
+		description TEXT    NOT NULL DEFAULT '',
+		icon        TEXT    NOT NULL DEFAULT '📁',
+		created_at  TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+
+	CREATE TABLE IF NOT EXISTS collection_assets (
+		collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+		asset_id      INTEGER NOT NULL REFERENCES assets(id)      ON DELETE CASCADE,
+		added_at      TEXT    NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (collection_id, asset_id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	// Databases from the earliest releases predate these columns
+	return addColumns(tx, "assets",
+		"favorited INTEGER NOT NULL DEFAULT 0",
+		"last_used_at TEXT DEFAULT ''",
+		"poly_count INTEGER NOT NULL DEFAULT 0",
+	)
+}
+
+func migrateMoveDetection(tx *sql.Tx) error {
+	if err := addColumns(tx, "assets",
+		"inode INTEGER NOT NULL DEFAULT 0",
+		"content_hash TEXT NOT NULL DEFAULT ''",
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_assets_inode ON assets(inode, file_size);
+		CREATE INDEX IF NOT EXISTS idx_assets_hash ON assets(content_hash);
+	`)
+	return err
+}
+
+func migrateModelMetadata(tx *sql.Tx) error {
+	return addColumns(tx, "assets",
+		"metadata_version INTEGER NOT NULL DEFAULT 0",
+		"vertex_count INTEGER NOT NULL DEFAULT 0",
+		"mesh_count INTEGER NOT NULL DEFAULT 0",
+		"material_count INTEGER NOT NULL DEFAULT 0",
+		"texture_count INTEGER NOT NULL DEFAULT 0",
+		"animation_count INTEGER NOT NULL DEFAULT 0",
+		"skin_count INTEGER NOT NULL DEFAULT 0",
+		"node_count INTEGER NOT NULL DEFAULT 0",
+		"bounds_x REAL NOT NULL DEFAULT 0",
+		"bounds_y REAL NOT NULL DEFAULT 0",
+		"bounds_z REAL NOT NULL DEFAULT 0",
+		"generator TEXT NOT NULL DEFAULT ''",
+		"copyright TEXT NOT NULL DEFAULT ''",
+		"extensions_used TEXT NOT NULL DEFAULT ''",
+	)
+}
+
+func migrateSmartCollections(tx *sql.Tx) error {
+	return addColumns(tx, "collections",
+		"kind TEXT NOT NULL DEFAULT 'manual'",
+		"query TEXT NOT NULL DEFAULT ''",
+	)
+}
+
+// migrateThumbnailFiles moves base64 thumbnails out of assets.thumbnail into the
+// thumbnail cache, leaving the cache key in the column. Images that can't be
+// decoded are dropped and will be re-rendered.
+func (d *Database) migrateThumbnailFiles(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, content_hash, thumbnail FROM assets WHERE thumbnail != ''")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type inline struct {
+		id         int64
+		hash, data string
+	}
+	var thumbs []inline
+	for rows.Next() {
+		var t inline
+		if err := rows.Scan(&t.id, &t.hash, &t.data); err != nil {
+			return err
+		}
+		thumbs = append(thumbs, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, t := range thumbs {
+		key := ""
+		if data, ext, err := decodeDataURL(t.data); err == nil {
+			if key, err = d.thumbs.Write(t.id, t.hash, "", data, ext); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("[db] warn: dropping unreadable thumbnail for asset %d: %v\n", t.id, err)
+		}
+		if _, err := tx.Exec("UPDATE assets SET thumbnail = ? WHERE id = ?", key, t.id); err != nil {
+			return err
+		}
+	}
+	if len(thumbs) > 0 {
+		fmt.Printf("[db] moved %d thumbnails to %s\n", len(thumbs), d.thumbs.dir)
+	}
+	return nil
+}
+
+func migrateSettings(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key   TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)
+	`)
+	return err
+}
+
+func migrateAssetPreviews(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS asset_previews (
+			asset_id  INTEGER PRIMARY KEY REFERENCES assets(id) ON DELETE CASCADE,
+			turntable TEXT    NOT NULL DEFAULT '',
+			frames    INTEGER NOT NULL DEFAULT 0,
+			views     TEXT    NOT NULL DEFAULT ''
+		)
+	`)
+	return err
+}
+
+// migrateSortIndexes backs each of assetSorts with an index on the same expression,
+// so a page of a sorted listing is an index seek rather than a sort of the table.
+// The id tie-break comes free, as every index ends with the rowid.
+func migrateSortIndexes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_assets_name      ON assets(filename COLLATE NOCASE);
+		CREATE INDEX IF NOT EXISTS idx_assets_created   ON assets(datetime(created_at));
+		CREATE INDEX IF NOT EXISTS idx_assets_modified  ON assets(datetime(modified_at));
+		CREATE INDEX IF NOT EXISTS idx_assets_size      ON assets(file_size);
+		CREATE INDEX IF NOT EXISTS idx_assets_poly      ON assets(poly_count);
+		CREATE INDEX IF NOT EXISTS idx_assets_last_used ON assets(last_used_at);
+	`)
+	return err
+}
+
+// migrateAssetDevices records the device each asset's file is on, as inode
+// numbers are only unique within one. Assets scanned before have 0, unknown.
+func migrateAssetDevices(tx *sql.Tx) error {
+	return addColumn(tx, "assets", "device", "INTEGER NOT NULL DEFAULT 0")
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// baselineSchema is the schema Sushi created before schema_version existed.
+const baselineSchema = `
+	CREATE TABLE watch_folders (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		path       TEXT    NOT NULL UNIQUE,
+		created_at TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE TABLE assets (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		absolute_path TEXT    NOT NULL UNIQUE,
+		filename      TEXT    NOT NULL,
+		folder_id     INTEGER NOT NULL REFERENCES watch_folders(id) ON DELETE CASCADE,
+		file_size     INTEGER NOT NULL DEFAULT 0,
+		modified_at   TEXT    NOT NULL DEFAULT '',
+		thumbnail     TEXT    NOT NULL DEFAULT '',
+		favorited     INTEGER NOT NULL DEFAULT 0,
+		last_used_at  TEXT    NOT NULL DEFAULT '',
+		poly_count    INTEGER NOT NULL DEFAULT 0,
+		created_at    TEXT    NOT NULL DEFAULT (datetime('now')),
+		updated_at    TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE INDEX idx_assets_folder ON assets(folder_id);
+	CREATE INDEX idx_assets_filename ON assets(filename);
+	CREATE TABLE tags (
+		id   INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT    NOT NULL UNIQUE
+	);
+	CREATE TABLE asset_tags (
+		asset_id INTEGER NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+		tag_id   INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (asset_id, tag_id)
+	);
+	CREATE TABLE collections (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		name        TEXT    NOT NULL UNIQUE,
+		description TEXT    NOT NULL DEFAULT '',
+		icon        TEXT    NOT NULL DEFAULT '📁',
+		created_at  TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE TABLE collection_assets (
+		collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+		asset_id      INTEGER NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+		added_at      TEXT    NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (collection_id, asset_id)
+	);
+`
+
+// thumbnailPNG is the payload of the inline thumbnail in the baseline library.
+var thumbnailPNG = []byte("\x89PNG\r\n\x1a\nthumbnail")
+
+// writeBaselineDatabase creates a library in the old schema at the path
+// NewDatabase will open, and returns its watch folder's path.
+func writeBaselineDatabase(t *testing.T) string {
+	t.Helper()
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	if err := os.MkdirAll(dataDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", filepath.Join(dataDir(), "sushi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root := filepath.Join(t.TempDir(), "library")
+	thumb := "data:image/png;base64," + base64.StdEncoding.EncodeToString(thumbnailPNG)
+	stmts := []struct {
+		query string
+		args  []any
+	}{
+		{baselineSchema, nil},
+		{"INSERT INTO watch_folders (id, path) VALUES (1, ?)", []any{root}},
+		{`INSERT INTO assets (id, absolute_path, filename, folder_id, file_size, thumbnail, favorited, last_used_at, poly_count)
+		  VALUES (1, ?, 'barrel.obj', 1, 2048, ?, 1, '2024-01-02 03:04:05', 320)`,
+			[]any{filepath.Join(root, "props", "barrel.obj"), thumb}},
+		{`INSERT INTO assets (id, absolute_path, filename, folder_id, file_size, thumbnail)
+		  VALUES (2, ?, 'stove.glb', 1, 4096, 'data:image/png;base64,@@@')`,
+			[]any{filepath.Join(root, "env", "kitchen", "stove.glb")}},
+		{"INSERT INTO tags (id, name) VALUES (1, 'Props'), (2, 'env / kitchen')", nil},
+		{"INSERT INTO asset_tags (asset_id, tag_id) VALUES (1, 1), (2, 2)", nil},
+		{"INSERT INTO collections (id, name) VALUES (1, 'Dungeon Kit')", nil},
+		{"INSERT INTO collection_assets (collection_id, asset_id) VALUES (1, 1)", nil},
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s.query, s.args...); err != nil {
+			t.Fatalf("baseline: %v\n%s", err, s.query)
+		}
+	}
+	return root
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	root := writeBaselineDatabase(t)
+
+	d, err := NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	migrations := d.migrations()
+	latest := migrations[len(migrations)-1].version
+	var applied, version int
+	if err := d.db.QueryRow("SELECT COUNT(*), MAX(version) FROM schema_version").Scan(&applied, &version); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) || version != latest {
+		t.Errorf("schema_version has %d steps up to v%d, want %d up to v%d", applied, version, len(migrations), latest)
+	}
+	backup := fmt.Sprintf("%s.pre-v%d.bak", d.path, latest)
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("no backup before migrating: %v", err)
+	}
+
+	barrel, err := d.GetAssetByPath(filepath.Join(root, "props", "barrel.obj"))
+	if err != nil {
+		t.Fatalf("barrel: %v", err)
+	}
+	if barrel.RelativePath != "props/barrel.obj" {
+		t.Errorf("barrel relative path = %q", barrel.RelativePath)
+	}
+	if barrel.Favorited != 1 || barrel.LastUsedAt != "2024-01-02 03:04:05" || barrel.PolyCount != 320 {
+		t.Errorf("barrel lost its details: favorited %d, last used %q, polys %d", barrel.Favorited, barrel.LastUsedAt, barrel.PolyCount)
+	}
+	if barrel.TrashedAt != "" || barrel.Offline {
+		t.Errorf("barrel trashed %q, offline %v", barrel.TrashedAt, barrel.Offline)
+	}
+
+	// The inline thumbnail moved into the cache; the unreadable one was dropped
+	var key string
+	d.db.QueryRow("SELECT thumbnail FROM assets WHERE id = ?", barrel.ID).Scan(&key)
+	if strings.HasPrefix(key, "data:") || key == "" {
+		t.Fatalf("barrel thumbnail = %q, want a cache key", key)
+	}
+	if path, ok := d.ThumbnailPath(key); !ok {
+		t.Errorf("thumbnail %q isn't in the cache", key)
+	} else if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, thumbnailPNG) {
+		t.Errorf("cached thumbnail = %q, %v", got, err)
+	}
+	var stoveThumb string
+	d.db.QueryRow("SELECT thumbnail FROM assets WHERE id = 2").Scan(&stoveThumb)
+	if stoveThumb != "" {
+		t.Errorf("stove thumbnail = %q, want it dropped", stoveThumb)
+	}
+
+	// Slashed tag names were cleaned up and hung under their parents
+	tags, err := d.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), "Props,env,env/kitchen"; got != want {
+		t.Errorf("tags = %s, want %s", got, want)
+	}
+	stoveTags, err := d.GetTagsForAsset(2)
+	if err != nil || len(stoveTags) != 1 || stoveTags[0].Name != "env/kitchen" {
+		t.Errorf("stove tags = %v, %v", stoveTags, err)
+	}
+
+	cols, err := d.ListCollections()
+	if err != nil || len(cols) != 1 || cols[0].Name != "Dungeon Kit" {
+		t.Fatalf("collections = %v, %v", cols, err)
+	}
+
+	// The search index covers the rows that were already there
+	for q, want := range map[string]int64{
+		"barrel":             1,
+		"tag:props":          1,
+		"tag:env/kitchen":    2,
+		`tray:"Dungeon Kit"`: 1,
+	} {
+		got, err := d.QueryAssets(q, "name", 10, 0)
+		if err != nil || len(got) != 1 || got[0].ID != want {
+			t.Errorf("QueryAssets(%q) = %v, %v; want asset %d", q, assetIDs(got), err, want)
+		}
+	}
+
+	// Opening it again has nothing left to do
+	d.Close()
+	os.Remove(backup)
+	d, err = NewDatabase()
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	d.db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&applied)
+	if applied != len(migrations) {
+		t.Errorf("reopening applied %d steps, want %d", applied, len(migrations))
+	}
+	if _, err := os.Stat(backup); err == nil {
+		t.Errorf("reopening backed up an up-to-date database")
+	}
+}
+
+func TestMigrateNewerDatabase(t *testing.T) {
+	d := newTestDatabase(t)
+	if _, err := d.db.Exec("INSERT INTO schema_version (version, name) VALUES (999, 'from the future')"); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	if d, err := NewDatabase(); err == nil {
+		d.Close()
+		t.Fatal("NewDatabase opened a database newer than it supports")
+	} else if !strings.Contains(err.Error(), "v999") {
+		t.Errorf("error = %v, want it to name the schema version", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// objExtractor reads geometry stats from Wavefront .obj files, plus texture
+// references from any .mtl libraries they point at.
+type objExtractor struct{}
+
+func (objExtractor) Version() int { return 2 }
+
+func (objExtractor) Extract(path string) (*ModelInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &ModelInfo{}
+	b := newBounds()
+	materials := make(map[string]bool)
+	var mtllibs []string
+	objects := 0
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		// Fields splits on tabs as well as spaces, which some exporters use
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch args := fields[1:]; fields[0] {
+		case "v":
+			info.VertexCount++
+			if len(args) >= 3 {
+				x, ex := strconv.ParseFloat(args[0], 64)
+				y, ey := strconv.ParseFloat(args[1], 64)
+				z, ez := strconv.ParseFloat(args[2], 64)
+				if ex == nil && ey == nil && ez == nil {
+					b.addPoint(x, y, z)
+				}
+			}
+		case "f":
+			// A polygon with n corners fans out into n-2 triangles
+			if n := int64(len(args)); n >= 3 {
+				info.TriangleCount += n - 2
+			}
+		case "o":
+			// Groups (g) are only named face sets within an object, so don't count
+			objects++
+		case "usemtl":
+			materials[strings.Join(args, " ")] = true
+		case "mtllib":
+			mtllibs = append(mtllibs, args...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if objects == 0 && info.TriangleCount > 0 {
+		objects = 1
+	}
+	info.MeshCount = int64(objects)
+	info.NodeCount = int64(objects)
+	info.MaterialCount = int64(len(materials))
+	info.TextureCount = int64(countMTLTextures(filepath.Dir(path), mtllibs))
+	info.Bounds = b.size()
+	return info, nil
+}
+
+// countMTLTextures counts the distinct texture maps referenced by .mtl files.
+// Missing or unreadable libraries are ignored.
+func countMTLTextures(dir string, libs []string) int {
+	textures := make(map[string]bool)
+	for _, lib := range libs {
+		f, err := os.Open(filepath.Join(dir, lib))
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) >= 2 && strings.HasPrefix(strings.ToLower(fields[0]), "map_") {
+				// The filename is the last field; options like -s 1 1 1 come first
+				textures[fields[len(fields)-1]] = true
+			}
+		}
+		f.Close()
+	}
+	return len(textures)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOBJExtract(t *testing.T) {
+	info, err := objExtractor{}.Extract(filepath.Join("testdata", "cube.obj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ModelInfo{
+		// Six quads and a triangle; the g groups are part of the Cube object
+		TriangleCount: 13,
+		VertexCount:   11,
+		MeshCount:     2,
+		NodeCount:     2,
+		MaterialCount: 2,
+		// wood.png is used twice
+		TextureCount: 2,
+		Bounds:       [3]float64{1, 2, 1},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("\n got %+v\nwant %+v", info, want)
+	}
+}
+
+func TestOBJExtractWithoutObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		objects int64
+	}{
+		// Loose faces make one implicit object
+		{"loose.obj", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n", 1},
+		{"groups.obj", "v 0 0 0\nv 1 0 0\nv 0 1 0\ng a\nf 1 2 3\ng b\nf 3 2 1\n", 1},
+		{"points.obj", "v 0 0 0\n", 0},
+	}
+	for _, tt := range tests {
+		info, err := objExtractor{}.Extract(writeFixture(t, tt.name, []byte(tt.data)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if info.MeshCount != tt.objects {
+			t.Errorf("%s: %d objects, want %d", tt.name, info.MeshCount, tt.objects)
+		}
+	}
+}
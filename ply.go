@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// plyExtractor reads vertex/face counts and bounds from ASCII and binary PLY files.
+type plyExtractor struct{}
+
+func (plyExtractor) Version() int { return 1 }
+
+type plyProperty struct {
+	name      string
+	typ       string // scalar type, or the item type for lists
+	listCount string // non-empty for list properties
+}
+
+type plyElement struct {
+	name  string
+	count int64
+	props []plyProperty
+}
+
+func (plyExtractor) Extract(path string) (*ModelInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	format, elements, err := readPLYHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ModelInfo{MeshCount: 1, NodeCount: 1}
+	b := newBounds()
+
+	var r plyReader
+	switch format {
+	case "ascii":
+		r = &plyASCIIReader{sc: bufio.NewScanner(br)}
+	case "binary_little_endian":
+		r = &plyBinaryReader{r: br, order: binary.LittleEndian}
+	case "binary_big_endian":
+		r = &plyBinaryReader{r: br, order: binary.BigEndian}
+	default:
+		return nil, fmt.Errorf("unsupported ply format %q", format)
+	}
+
+	for _, el := range elements {
+		if el.name == "vertex" {
+			info.VertexCount = el.count
+		}
+		for i := int64(0); i < el.count; i++ {
+			if err := r.startRow(); err != nil {
+				return nil, fmt.Errorf("read %s %d: %w", el.name, i, err)
+			}
+			var xyz [3]float64
+			for _, p := range el.props {
+				if p.listCount != "" {
+					n, err := r.read(p.listCount)
+					if err != nil {
+						return nil, err
+					}
+					for j := 0; j < int(n); j++ {
+						if _, err := r.read(p.typ); err != nil {
+							return nil, err
+						}
+					}
+					if el.name == "face" && n >= 3 {
+						info.TriangleCount += int64(n) - 2
+					}
+					continue
+				}
+				v, err := r.read(p.typ)
+				if err != nil {
+					return nil, err
+				}
+				if el.name == "vertex" {
+					switch p.name {
+					case "x":
+						xyz[0] = v
+					case "y":
+						xyz[1] = v
+					case "z":
+						xyz[2] = v
+					}
+				}
+			}
+			if el.name == "vertex" {
+				b.addPoint(xyz[0], xyz[1], xyz[2])
+			}
+		}
+		// Nothing after the faces matters for stats
+		if el.name == "face" {
+			break
+		}
+	}
+
+	info.Bounds = b.size()
+	return info, nil
+}
+
+func readPLYHeader(r *bufio.Reader) (string, []plyElement, error) {
+	magic, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(magic) != "ply" {
+		return "", nil, errors.New("not a PLY file")
+	}
+	var format string
+	var elements []plyElement
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, fmt.Errorf("read ply header: %w", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			if len(fields) >= 2 {
+				format = fields[1]
+			}
+		case "element":
+			if len(fields) < 3 {
+				return "", nil, fmt.Errorf("bad ply element line %q", strings.TrimSpace(line))
+			}
+			count, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("bad ply element count: %w", err)
+			}
+			elements = append(elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return "", nil, errors.New("ply property before any element")
+			}
+			el := &elements[len(elements)-1]
+			if len(fields) >= 5 && fields[1] == "list" {
+				el.props = append(el.props, plyProperty{name: fields[4], typ: fields[3], listCount: fields[2]})
+			} else if len(fields) >= 3 {
+				el.props = append(el.props, plyProperty{name: fields[2], typ: fields[1]})
+			}
+		case "end_header":
+			return format, elements, nil
+		}
+	}
+}
+
+// plyReader reads scalar values from the body of a PLY file.
+type plyReader interface {
+	startRow() error
+	read(typ string) (float64, error)
+}
+
+type plyASCIIReader struct {
+	sc     *bufio.Scanner
+	fields []string
+}
+
+func (a *plyASCIIReader) startRow() error {
+	for a.sc.Scan() {
+		a.fields = strings.Fields(a.sc.Text())
+		if len(a.fields) > 0 {
+			return nil
+		}
+	}
+	if err := a.sc.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+func (a *plyASCIIReader) read(string) (float64, error) {
+	if len(a.fields) == 0 {
+		return 0, errors.New("ply row too short")
+	}
+	v, err := strconv.ParseFloat(a.fields[0], 64)
+	a.fields = a.fields[1:]
+	return v, err
+}
+
+type plyBinaryReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	buf   [8]byte
+}
+
+func (p *plyBinaryReader) startRow() error { return nil }
+
+func (p *plyBinaryReader) read(typ string) (float64, error) {
+	size := plyTypeSize(typ)
+	if size == 0 {
+		return 0, fmt.Errorf("unknown ply type %q", typ)
+	}
+	b := p.buf[:size]
+	if _, err := io.ReadFull(p.r, b); err != nil {
+		return 0, err
+	}
+	switch typ {
+	case "char", "int8":
+		return float64(int8(b[0])), nil
+	case "uchar", "uint8":
+		return float64(b[0]), nil
+	case "short", "int16":
+		return float64(int16(p.order.Uint16(b))), nil
+	case "ushort", "uint16":
+		return float64(p.order.Uint16(b)), nil
+	case "int", "int32":
+		return float64(int32(p.order.Uint32(b))), nil
+	case "uint", "uint32":
+		return float64(p.order.Uint32(b)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(p.order.Uint32(b))), nil
+	default: // double, float64
+		return math.Float64frombits(p.order.Uint64(b)), nil
+	}
+}
+
+func plyTypeSize(typ string) int {
+	switch typ {
+	case "char", "int8", "uchar", "uint8":
+		return 1
+	case "short", "int16", "ushort", "uint16":
+		return 2
+	case "int", "int32", "uint", "uint32", "float", "float32":
+		return 4
+	case "double", "float64":
+		return 8
+	}
+	return 0
+}
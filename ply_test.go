@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// binaryHousePLY encodes testdata/house.ply in a binary PLY format.
+func binaryHousePLY(format string, order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ply\nformat " + format + " 1.0\n" +
+		"element vertex 5\nproperty float x\nproperty float y\nproperty float z\nproperty uchar red\n" +
+		"element face 2\nproperty list uchar int vertex_indices\n" +
+		"element edge 1\nproperty int vertex1\nproperty int vertex2\n" +
+		"end_header\n")
+	for _, v := range [][3]float32{{0, 0, 0}, {2, 0, 0}, {2, 2, 0}, {0, 2, 0}, {1, 3, 0.5}} {
+		binary.Write(&buf, order, v)
+		buf.WriteByte(255)
+	}
+	for _, face := range [][]int32{{0, 1, 2, 3}, {3, 2, 4}} {
+		buf.WriteByte(byte(len(face)))
+		binary.Write(&buf, order, face)
+	}
+	binary.Write(&buf, order, []int32{0, 1})
+	return buf.Bytes()
+}
+
+func TestPLYExtract(t *testing.T) {
+	want := &ModelInfo{
+		// A quad and a triangle
+		TriangleCount: 3,
+		VertexCount:   5,
+		MeshCount:     1,
+		NodeCount:     1,
+		Bounds:        [3]float64{2, 3, 0.5},
+	}
+	for _, path := range []string{
+		filepath.Join("testdata", "house.ply"),
+		writeFixture(t, "le.ply", binaryHousePLY("binary_little_endian", binary.LittleEndian)),
+		writeFixture(t, "be.ply", binaryHousePLY("binary_big_endian", binary.BigEndian)),
+	} {
+		info, err := plyExtractor{}.Extract(path)
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+			continue
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", filepath.Base(path), info, want)
+		}
+	}
+}
+
+func TestPLYExtractErrors(t *testing.T) {
+	house := string(readFixture(t, "house.ply"))
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"obj.ply", "v 0 0 0\n", "not a PLY file"},
+		{"header.ply", "ply\nformat ascii 1.0\nelement vertex 1\n", "read ply header"},
+		{"count.ply", "ply\nformat ascii 1.0\nelement vertex many\nend_header\n", "bad ply element count"},
+		{"property.ply", "ply\nformat ascii 1.0\nproperty float x\nend_header\n", "ply property before any element"},
+		{"format.ply", "ply\nformat utf8 1.0\nend_header\n", `unsupported ply format "utf8"`},
+		{"short.ply", house[:strings.Index(house, "3 3 2 4")], "read face 1"},
+	}
+	for _, tt := range tests {
+		_, err := plyExtractor{}.Extract(writeFixture(t, tt.name, []byte(tt.data)))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The query language is a space-separated list of terms, all of which must match:
+//
+//	crate                   full-text search (see SearchAssets); a tag alias also
+//	                        finds its tag
+//	tag:prop  -tag:wip      has / doesn't have a tag (or one beneath it, for tag:style)
+//	tray:"PSX Kit"          in a tray (manual collection)
+//	ext:gltf                file extension
+//	folder:kitbash          directory path contains the text
+//	name:barrel             filename contains the text
+//	poly<5000  verts>=10k   triangle / vertex count
+//	size>2MB                file size (B, KB, MB, GB)
+//	added:<7d  used:>1m     age (h, d, w, m, y) or date (2024-01-31)
+//	fav:yes  tagged:no      yes/no flags
+//
+// Any term can be negated with a leading '-', and values containing spaces can be quoted.
+
+// QueryError is a problem with a query string, reported back to the UI.
+type QueryError struct {
+	Pos int // 1-based column of the offending term
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s (column %d)", e.Msg, e.Pos)
+}
+
+// queryTerm is one parsed term of a query.
+type queryTerm struct {
+	pos    int
+	negate bool
+	key    string // empty for free text
+	op     string // ":", "=", "<", "<=", ">", ">="
+	value  string
+	// valuePos and end are the rune offsets of the value, quotes included, and of
+	// the end of the term.
+	valuePos, end int
+}
+
+// parseQuery splits a query string into terms.
+func parseQuery(q string) ([]queryTerm, error) {
+	var terms []queryTerm
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		t := queryTerm{pos: i + 1}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			t.negate = true
+			i++
+		}
+
+		// A key is a run of letters directly followed by an operator
+		k := i
+		for k < len(runes) && unicode.IsLetter(runes[k]) {
+			k++
+		}
+		if k > i && k < len(runes) && strings.ContainsRune(":=<>", runes[k]) {
+			t.key = strings.ToLower(string(runes[i:k]))
+			i = k
+			t.op = string(runes[i])
+			i++
+			if t.op == ":" && i < len(runes) && strings.ContainsRune("=<>", runes[i]) {
+				t.op = string(runes[i]) // "added:<7d" reads as "added<7d"
+				i++
+			}
+			if (t.op == "<" || t.op == ">") && i < len(runes) && runes[i] == '=' {
+				t.op += "="
+				i++
+			}
+		}
+
+		// The value runs to the next space outside quotes
+		t.valuePos = i
+		var value strings.Builder
+		quoted := false
+		for ; i < len(runes) && (quoted || !unicode.IsSpace(runes[i])); i++ {
+			if runes[i] == '"' {
+				quoted = !quoted
+				continue
+			}
+			value.WriteRune(runes[i])
+		}
+		if quoted {
+			return nil, &QueryError{t.pos, "unterminated quote"}
+		}
+		t.value = value.String()
+		t.end = i
+		if t.key != "" && t.value == "" {
+			return nil, &QueryError{t.pos, fmt.Sprintf("%s: missing value", t.key)}
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// compiledQuery is a query translated into SQL over the assets table (aliased a).
+type compiledQuery struct {
+	where []string
+	args  []interface{}
+	// text is the FTS5 match expression for the positive free-text terms, if any.
+	text string
+}
+
+// queryField compiles a key:value term into a SQL condition.
+type queryField func(t queryTerm) (string, []interface{}, error)
+
+// assetDirSQL is the directory part of an asset's path, with a trailing separator.
+const assetDirSQL = "substr(a.absolute_path, 1, length(a.absolute_path) - length(a.filename))"
+
+var queryFields map[string]queryField
+
+func init() {
+	tag := func(t queryTerm) (string, []interface{}, error) {
+		return anyTagSQL(1), []interface{}{t.value}, nil
+	}
+	tray := func(t queryTerm) (string, []interface{}, error) {
+		return `EXISTS (SELECT 1 FROM collection_assets ca JOIN collections c ON c.id = ca.collection_id
+			WHERE ca.asset_id = a.id AND c.name = ? COLLATE NOCASE)`, []interface{}{t.value}, nil
+	}
+	ext := func(t queryTerm) (string, []interface{}, error) {
+		e := "." + strings.TrimPrefix(strings.ToLower(t.value), ".")
+		return "lower(a.filename) LIKE ? ESCAPE '\\'", []interface{}{"%" + escapeLike(e)}, nil
+	}
+	folder := func(t queryTerm) (string, []interface{}, error) {
+		return assetDirSQL + " LIKE ? ESCAPE '\\'", []interface{}{"%" + escapeLike(t.value) + "%"}, nil
+	}
+	name := func(t queryTerm) (string, []interface{}, error) {
+		return "a.filename LIKE ? ESCAPE '\\'", []interface{}{"%" + escapeLike(t.value) + "%"}, nil
+	}
+	poly := countField("a.poly_count")
+	verts := countField("a.vertex_count")
+	fav := flagField("a.favorited = 1")
+	tagged := flagField(taggedSQL)
+
+	queryFields = map[string]queryField{
+		"tag":        tag,
+		"tags":       tag,
+		"tray":       tray,
+		"collection": tray,
+		"ext":        ext,
+		"type":       ext,
+		"folder":     folder,
+		"dir":        folder,
+		"path":       folder,
+		"name":       name,
+		"file":       name,
+		"poly":       poly,
+		"polys":      poly,
+		"tris":       poly,
+		"verts":      verts,
+		"vertices":   verts,
+		"size":       sizeField,
+		"added":      timeField("a.created_at"),
+		"modified":   timeField("a.modified_at"),
+		"used":       timeField("a.last_used_at"),
+		"fav":        fav,
+		"favorite":   fav,
+		"tagged":     tagged,
+	}
+}
+
+// compileQuery parses q and translates it into SQL conditions. Free-text terms
+// that are tag aliases (lowercased, mapped to their tag's name) also match the tag.
+func compileQuery(q string, aliases map[string]string) (*compiledQuery, error) {
+	terms, err := parseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledQuery{}
+	var text []string
+	for _, t := range terms {
+		var cond string
+		var args []interface{}
+		if t.key == "" {
+			match := ftsTermExpr(t.value, aliases)
+			if match == "" {
+				continue
+			}
+			if !t.negate {
+				text = append(text, match)
+				continue
+			}
+			cond = "a.id IN (SELECT rowid FROM asset_search WHERE asset_search MATCH ?)"
+			args = []interface{}{match}
+		} else {
+			field, ok := queryFields[t.key]
+			if !ok {
+				return nil, &QueryError{t.pos, fmt.Sprintf("unknown field %q", t.key)}
+			}
+			cond, args, err = field(t)
+			if err != nil {
+				return nil, &QueryError{t.pos, fmt.Sprintf("%s: %v", t.key, err)}
+			}
+		}
+		if t.negate {
+			// COALESCE so that NULL comparisons (e.g. never used) count as not matching
+			cond = "NOT COALESCE((" + cond + "), 0)"
+		}
+		c.where = append(c.where, cond)
+		c.args = append(c.args, args...)
+	}
+	c.text = strings.Join(text, " ")
+	return c, nil
+}
+
+// renameTagTerms rewrites the tag terms of q that name any of from (ignoring
+// case) to name to instead, reporting whether anything changed.
+func renameTagTerms(q string, from []string, to string) (string, bool) {
+	terms, err := parseQuery(q)
+	if err != nil {
+		return q, false
+	}
+	value := []rune(to)
+	if strings.IndexFunc(to, unicode.IsSpace) >= 0 {
+		value = []rune(`"` + to + `"`)
+	}
+	runes := []rune(q)
+	changed := false
+	// Backwards, so the offsets of earlier terms stay valid
+	for i := len(terms) - 1; i >= 0; i-- {
+		t := terms[i]
+		if t.key != "tag" && t.key != "tags" {
+			continue
+		}
+		for _, name := range from {
+			if strings.EqualFold(t.value, name) {
+				runes = append(runes[:t.valuePos], append(value, runes[t.end:]...)...)
+				changed = true
+				break
+			}
+		}
+	}
+	return string(runes), changed
+}
+
+// countField compares an integer column; values accept k/m suffixes (10k, 1.5m).
+func countField(col string) queryField {
+	return func(t queryTerm) (string, []interface{}, error) {
+		n, err := parseScaled(t.value, map[string]float64{"": 1, "k": 1e3, "m": 1e6})
+		if err != nil {
+			return "", nil, err
+		}
+		return col + " " + sqlOp(t.op) + " ?", []interface{}{int64(math.Round(n))}, nil
+	}
+}
+
+func sizeField(t queryTerm) (string, []interface{}, error) {
+	n, err := parseScaled(t.value, map[string]float64{
+		"": 1, "b": 1, "k": 1 << 10, "kb": 1 << 10, "m": 1 << 20, "mb": 1 << 20, "g": 1 << 30, "gb": 1 << 30,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return "a.file_size " + sqlOp(t.op) + " ?", []interface{}{int64(math.Round(n))}, nil
+}
+
+// flagField matches yes/no values against a boolean condition.
+func flagField(cond string) queryField {
+	return func(t queryTerm) (string, []interface{}, error) {
+		if t.op != ":" && t.op != "=" {
+			return "", nil, fmt.Errorf("use %s:yes or %s:no", t.key, t.key)
+		}
+		switch strings.ToLower(t.value) {
+		case "yes", "y", "true", "1":
+			return cond, nil, nil
+		case "no", "n", "false", "0":
+			return "NOT (" + cond + ")", nil, nil
+		}
+		return "", nil, fmt.Errorf("expected yes or no, got %q", t.value)
+	}
+}
+
+// timeField compares a timestamp column against either an age ("7d": less than
+// seven days ago with '<', more with '>') or a calendar date.
+func timeField(col string) queryField {
+	// Timestamps are stored both as RFC 3339 and as SQLite datetime text; datetime() normalises them
+	expr := "datetime(" + col + ")"
+	return func(t queryTerm) (string, []interface{}, error) {
+		if date, err := time.ParseInLocation("2006-01-02", t.value, time.Local); err == nil {
+			start := date.UTC().Format(sqliteTimeLayout)
+			end := date.AddDate(0, 0, 1).UTC().Format(sqliteTimeLayout)
+			switch t.op {
+			case "<":
+				return expr + " < ?", []interface{}{start}, nil
+			case "<=":
+				return expr + " < ?", []interface{}{end}, nil
+			case ">":
+				return expr + " >= ?", []interface{}{end}, nil
+			case ">=":
+				return expr + " >= ?", []interface{}{start}, nil
+			default:
+				return expr + " >= ? AND " + expr + " < ?", []interface{}{start, end}, nil
+			}
+		}
+
+		age, err := parseAge(t.value)
+		if err != nil {
+			return "", nil, err
+		}
+		cutoff := time.Now().Add(-age).UTC().Format(sqliteTimeLayout)
+		// Ages run the opposite way to timestamps: younger than 7d means after the cutoff
+		switch t.op {
+		case "<", "<=", ":", "=":
+			return expr + " >= ?", []interface{}{cutoff}, nil
+		default:
+			return expr + " < ?", []interface{}{cutoff}, nil
+		}
+	}
+}
+
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// parseAge reads durations like 12h, 7d, 2w, 3m (30-day months) and 1y.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]float64{"h": 1, "d": 24, "w": 24 * 7, "m": 24 * 30, "y": 24 * 365}
+	n, err := parseScaled(s, units)
+	if err != nil {
+		return 0, fmt.Errorf("expected an age like 7d or a date like 2024-01-31, got %q", s)
+	}
+	return time.Duration(n * float64(time.Hour)), nil
+}
+
+// parseScaled parses a non-negative number with an optional unit suffix.
+func parseScaled(s string, units map[string]float64) (float64, error) {
+	lower := strings.ToLower(s)
+	i := strings.IndexFunc(lower, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if i < 0 {
+		i = len(lower)
+	}
+	n, err := strconv.ParseFloat(lower[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number, got %q", s)
+	}
+	scale, ok := units[lower[i:]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", s[i:])
+	}
+	return n * scale, nil
+}
+
+// sqlOp maps a query operator to SQL; ':' means equality.
+func sqlOp(op string) string {
+	if op == ":" {
+		return "="
+	}
+	return op
+}
+
+// escapeLike escapes LIKE wildcards so user text matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// assetSorts maps sort keys, as used by the frontend, to ORDER BY expressions.
+// Prefix a key with '-' to sort descending.
+var assetSorts = map[string]string{
+	"name":          "a.filename COLLATE NOCASE",
+	"date-added":    "datetime(a.created_at)",
+	"file-modified": "datetime(a.modified_at)",
+	"file-size":     "a.file_size",
+	"poly-count":    "a.poly_count",
+	"last-used":     "a.last_used_at",
+}
+
+// orderBy returns the ORDER BY clause for a sort key. An empty key sorts by
+// relevance when there is free text, otherwise by name.
+func orderBy(sort string, hasText bool) (string, error) {
+	col, desc, err := sortColumn(sort, hasText)
+	if err != nil {
+		return "", err
+	}
+	if col == "" {
+		return "s.rank, a.filename COLLATE NOCASE", nil
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, a.id %s", col, dir, dir), nil
+}
+
+// sortColumn resolves a sort key to its assetSorts expression and direction. The
+// expression is empty when sorting by relevance.
+func sortColumn(sort string, hasText bool) (string, bool, error) {
+	if sort == "" || sort == "relevance" {
+		if hasText {
+			return "", false, nil
+		}
+		sort = "name"
+	}
+	desc := strings.HasPrefix(sort, "-")
+	col, ok := assetSorts[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return "", false, fmt.Errorf("unknown sort %q", sort)
+	}
+	return col, desc, nil
+}
+
+// fromWhere returns the FROM and WHERE clauses selecting matching assets as a,
+// joined to their search rank as s when there is free text.
+func (c *compiledQuery) fromWhere() (string, []interface{}) {
+	from := "FROM assets a"
+	var args []interface{}
+	if c.text != "" {
+		from = `FROM assets a JOIN (
+			SELECT rowid, bm25(asset_search, ` + searchWeights + `) AS rank
+			FROM asset_search WHERE asset_search MATCH ?
+		) s ON s.rowid = a.id`
+		args = append(args, c.text)
+	}
+	if len(c.where) > 0 {
+		from += "\nWHERE " + strings.Join(c.where, " AND ")
+	}
+	return from, append(args, c.args...)
+}
+
+// QueryAssets runs a query-language search (see the top of query.go). A limit of
+// zero or less returns every match.
+func (d *Database) QueryAssets(q string, sort string, limit int, offset int) ([]Asset, error) {
+	return d.FilterAssets(AssetFilter{Text: q}, sort, limit, offset)
+}
+
+// CountQueryAssets returns how many assets match a query.
+func (d *Database) CountQueryAssets(q string) (int, error) {
+	return d.CountAssets(AssetFilter{Text: q})
+}
+
+// --- Paging ---
+
+// Page sizes for ListAssetsPage.
+const (
+	defaultPageSize = 200
+	maxPageSize     = 1000
+)
+
+// AssetPage is one page of a sorted asset listing.
+type AssetPage struct {
+	Assets []Asset `json:"assets"`
+	Total  int     `json:"total"`
+	// NextCursor fetches the following page; it is empty on the last one.
+	NextCursor string `json:"next_cursor"`
+}
+
+// pageCursor is the decoded form of AssetPage.NextCursor. Column sorts resume
+// after the last row's sort value and id, so each page is an index seek and
+// pages don't shift when assets are added or removed in between. Relevance has
+// no stable key and resumes at an offset instead.
+type pageCursor struct {
+	Sort   string      `json:"s"`
+	Key    interface{} `json:"k,omitempty"`
+	ID     int64       `json:"i,omitempty"`
+	Offset int         `json:"o,omitempty"`
+}
+
+func (c pageCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageCursor(s string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var c pageCursor
+	if err := dec.Decode(&c); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	// Integer keys must stay integers to compare like the column does
+	if n, ok := c.Key.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			c.Key = i
+		} else if f, err := n.Float64(); err == nil {
+			c.Key = f
+		}
+	}
+	return &c, nil
+}
+
+// ListAssetsPage returns up to limit assets matching a filter, starting after
+// cursor ("" for the first page), along with the total number of matches.
+func (d *Database) ListAssetsPage(f AssetFilter, sort string, cursor string, limit int) (*AssetPage, error) {
+	c, err := d.compileFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	col, desc, err := sortColumn(sort, c.text != "")
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	after := &pageCursor{Sort: sort}
+	if cursor != "" {
+		if after, err = decodePageCursor(cursor); err != nil {
+			return nil, err
+		}
+		if after.Sort != sort {
+			return nil, errors.New("cursor is for a different sort order")
+		}
+	}
+
+	from, args := c.fromWhere()
+	page := &AssetPage{}
+	if err := d.db.QueryRow("SELECT COUNT(*) "+from, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	var order string
+	offset := 0
+	keyCol := "NULL"
+	if col == "" {
+		order = "s.rank, a.filename COLLATE NOCASE, a.id"
+		offset = after.Offset
+	} else {
+		cmp, dir := ">", "ASC"
+		if desc {
+			cmp, dir = "<", "DESC"
+		}
+		if cursor != "" {
+			// The first term lets SQLite seek expression indexes, which it won't do
+			// for a row value alone
+			seek := fmt.Sprintf("%[1]s %[2]s= ? AND (%[1]s, a.id) %[2]s (?, ?)", col, cmp)
+			if len(c.where) > 0 {
+				from += " AND " + seek
+			} else {
+				from += "\nWHERE " + seek
+			}
+			args = append(args, after.Key, after.Key, after.ID)
+		}
+		order = fmt.Sprintf("%s %s, a.id %s", col, dir, dir)
+		keyCol = col
+	}
+	// One extra row tells whether there is another page
+	args = append(args, limit+1, offset)
+
+	rows, err := d.db.Query(`
+		SELECT `+assetColumns+`, `+keyCol+`
+		`+from+`
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var key, lastKey interface{}
+	for rows.Next() {
+		a, err := d.scanAsset(rows, &key)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Assets) == limit {
+			next := pageCursor{Sort: sort, Offset: offset + limit}
+			if col != "" {
+				next = pageCursor{Sort: sort, Key: lastKey, ID: page.Assets[limit-1].ID}
+			}
+			page.NextCursor = next.encode()
+			break
+		}
+		page.Assets = append(page.Assets, a)
+		lastKey = key
+	}
+	return page, rows.Err()
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDatabase opens a fresh database in a temporary data directory.
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	d, err := NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// addTestAsset records an asset without a file behind it.
+func addTestAsset(t *testing.T, d *Database, folder *WatchFolder, rel string, size int64) *Asset {
+	t.Helper()
+	path := filepath.Join(folder.Path, filepath.FromSlash(rel))
+	a, err := d.UpsertAsset(path, *folder, size, time.Now(), 0, 0)
+	if err != nil {
+		t.Fatalf("UpsertAsset %s: %v", rel, err)
+	}
+	return a
+}
+
+func TestParseQuery(t *testing.T) {
+	type term struct {
+		negate         bool
+		key, op, value string
+	}
+	tests := []struct {
+		q    string
+		want []term
+	}{
+		{"", nil},
+		{"  crate  ", []term{{value: "crate"}}},
+		{"crate barrel", []term{{value: "crate"}, {value: "barrel"}}},
+		{"tag:prop", []term{{key: "tag", op: ":", value: "prop"}}},
+		{"TAG:Prop", []term{{key: "tag", op: ":", value: "Prop"}}},
+		{"-tag:wip", []term{{negate: true, key: "tag", op: ":", value: "wip"}}},
+		{"-crate", []term{{negate: true, value: "crate"}}},
+		{"- crate", []term{{value: "-"}, {value: "crate"}}},
+		{`tray:"PSX Kit"`, []term{{key: "tray", op: ":", value: "PSX Kit"}}},
+		{`"wooden crate"`, []term{{value: "wooden crate"}}},
+		{"poly<5000", []term{{key: "poly", op: "<", value: "5000"}}},
+		{"verts>=10k", []term{{key: "verts", op: ">=", value: "10k"}}},
+		{"size<=2MB", []term{{key: "size", op: "<=", value: "2MB"}}},
+		{"added:<7d", []term{{key: "added", op: "<", value: "7d"}}},
+		{"used:>=2024-01-31", []term{{key: "used", op: ">=", value: "2024-01-31"}}},
+		{"fav=yes", []term{{key: "fav", op: "=", value: "yes"}}},
+		{"http://x", []term{{key: "http", op: ":", value: "//x"}}},
+		{"v1:2", []term{{value: "v1:2"}}},
+	}
+	for _, tt := range tests {
+		terms, err := parseQuery(tt.q)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.q, err)
+			continue
+		}
+		var got []term
+		for _, pt := range terms {
+			got = append(got, term{pt.negate, pt.key, pt.op, pt.value})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQuery(%q) = %+v, want %+v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		q   string
+		pos int
+		msg string
+	}{
+		{`tray:"PSX Kit`, 1, "unterminated quote"},
+		{`crate "open`, 7, "unterminated quote"},
+		{"crate tag:", 7, "tag: missing value"},
+		{"poly<", 1, "poly: missing value"},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.q)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("parseQuery(%q) error = %v, want a QueryError", tt.q, err)
+			continue
+		}
+		if qe.Pos != tt.pos || qe.Msg != tt.msg {
+			t.Errorf("parseQuery(%q) error = %d %q, want %d %q", tt.q, qe.Pos, qe.Msg, tt.pos, tt.msg)
+		}
+	}
+}
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		q     string
+		where []string
+		args  []interface{}
+		text  string
+	}{
+		{"crate", nil, nil, `"crate"*`},
+		{"wooden crate", nil, nil, `"wooden"* "crate"*`},
+		{"-crate", []string{`NOT COALESCE((a.id IN (SELECT rowid FROM asset_search WHERE asset_search MATCH ?)), 0)`}, []interface{}{`"crate"*`}, ""},
+		{"size>2MB", []string{"a.file_size > ?"}, []interface{}{int64(2 << 20)}, ""},
+		{"size:512", []string{"a.file_size = ?"}, []interface{}{int64(512)}, ""},
+		{"poly<5k", []string{"a.poly_count < ?"}, []interface{}{int64(5000)}, ""},
+		{"verts>=1.5m", []string{"a.vertex_count >= ?"}, []interface{}{int64(1500000)}, ""},
+		{"ext:GLTF", []string{`lower(a.filename) LIKE ? ESCAPE '\'`}, []interface{}{"%.gltf"}, ""},
+		{"type:.stl", []string{`lower(a.filename) LIKE ? ESCAPE '\'`}, []interface{}{"%.stl"}, ""},
+		{"name:50%_off", []string{`a.filename LIKE ? ESCAPE '\'`}, []interface{}{`%50\%\_off%`}, ""},
+		{"folder:kit", []string{assetDirSQL + ` LIKE ? ESCAPE '\'`}, []interface{}{"%kit%"}, ""},
+		{"fav:yes", []string{"a.favorited = 1"}, nil, ""},
+		{"fav:no", []string{"NOT (a.favorited = 1)"}, nil, ""},
+		{"tagged:no", []string{"NOT (" + taggedSQL + ")"}, nil, ""},
+		{"-fav:yes", []string{"NOT COALESCE((a.favorited = 1), 0)"}, nil, ""},
+		{"tag:prop", []string{anyTagSQL(1)}, []interface{}{"prop"}, ""},
+		{
+			"crate size<1k fav:yes",
+			[]string{"a.file_size < ?", "a.favorited = 1"},
+			[]interface{}{int64(1024)},
+			`"crate"*`,
+		},
+	}
+	for _, tt := range tests {
+		c, err := compileQuery(tt.q, nil)
+		if err != nil {
+			t.Errorf("compileQuery(%q): %v", tt.q, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.where, tt.where) || !reflect.DeepEqual(c.args, tt.args) || c.text != tt.text {
+			t.Errorf("compileQuery(%q) = %q %v %q, want %q %v %q", tt.q, c.where, c.args, c.text, tt.where, tt.args, tt.text)
+		}
+	}
+}
+
+func TestCompileQueryDates(t *testing.T) {
+	day := time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local)
+	start := day.UTC().Format(sqliteTimeLayout)
+	end := day.AddDate(0, 0, 1).UTC().Format(sqliteTimeLayout)
+	expr := "datetime(a.created_at)"
+	tests := []struct {
+		q     string
+		where string
+		args  []interface{}
+	}{
+		{"added:2024-01-31", expr + " >= ? AND " + expr + " < ?", []interface{}{start, end}},
+		{"added<2024-01-31", expr + " < ?", []interface{}{start}},
+		{"added<=2024-01-31", expr + " < ?", []interface{}{end}},
+		{"added>2024-01-31", expr + " >= ?", []interface{}{end}},
+		{"added>=2024-01-31", expr + " >= ?", []interface{}{start}},
+	}
+	for _, tt := range tests {
+		c, err := compileQuery(tt.q, nil)
+		if err != nil {
+			t.Errorf("compileQuery(%q): %v", tt.q, err)
+			continue
+		}
+		if len(c.where) != 1 || c.where[0] != tt.where || !reflect.DeepEqual(c.args, tt.args) {
+			t.Errorf("compileQuery(%q) = %q %v, want %q %v", tt.q, c.where, c.args, tt.where, tt.args)
+		}
+	}
+
+	// Ages compare against a cutoff: younger than 7d is after it
+	before := time.Now().Add(-7 * 24 * time.Hour).UTC().Format(sqliteTimeLayout)
+	c, err := compileQuery("used:<7d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Add(-7 * 24 * time.Hour).UTC().Format(sqliteTimeLayout)
+	if len(c.where) != 1 || c.where[0] != "datetime(a.last_used_at) >= ?" {
+		t.Fatalf("used:<7d compiled to %q", c.where)
+	}
+	if cutoff := c.args[0].(string); cutoff < before || cutoff > after {
+		t.Errorf("used:<7d cutoff = %s, want between %s and %s", cutoff, before, after)
+	}
+	if c, err := compileQuery("used>1y", nil); err != nil || c.where[0] != "datetime(a.last_used_at) < ?" {
+		t.Errorf("used>1y compiled to %v, %v", c, err)
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	tests := []struct {
+		q   string
+		pos int
+		msg string
+	}{
+		{"colour:red", 1, `unknown field "colour"`},
+		{"crate poly<lots", 7, `poly: expected a number, got "lots"`},
+		{"size>2TB", 1, `size: unknown unit "TB"`},
+		{"fav<yes", 1, "fav: use fav:yes or fav:no"},
+		{"fav:maybe", 1, `fav: expected yes or no, got "maybe"`},
+		{"added<soon", 1, `added: expected an age like 7d or a date like 2024-01-31, got "soon"`},
+	}
+	for _, tt := range tests {
+		_, err := compileQuery(tt.q, nil)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("compileQuery(%q) error = %v, want a QueryError", tt.q, err)
+			continue
+		}
+		if qe.Pos != tt.pos || qe.Msg != tt.msg {
+			t.Errorf("compileQuery(%q) error = %d %q, want %d %q", tt.q, qe.Pos, qe.Msg, tt.pos, tt.msg)
+		}
+	}
+}
+
+func TestCompileQueryAliases(t *testing.T) {
+	c, err := compileQuery("Seat", map[string]string{"seat": "furniture/chair"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `(("Seat"*) OR tags : "furniture/chair")`; c.text != want {
+		t.Errorf("text = %q, want %q", c.text, want)
+	}
+}
+
+func TestRenameTagTerms(t *testing.T) {
+	tests := []struct {
+		q, to   string
+		want    string
+		changed bool
+	}{
+		{"tag:chair -tag:Chair crate", "seat", "tag:seat -tag:seat crate", true},
+		{"tag:chairs", "seat", "tag:chairs", false},
+		{`tags:"chair" fav:yes`, "office chair", `tags:"office chair" fav:yes`, true},
+		{"chair", "seat", "chair", false},
+	}
+	for _, tt := range tests {
+		got, changed := renameTagTerms(tt.q, []string{"chair"}, tt.to)
+		if got != tt.want || changed != tt.changed {
+			t.Errorf("renameTagTerms(%q, %q) = %q %v, want %q %v", tt.q, tt.to, got, changed, tt.want, tt.changed)
+		}
+	}
+}
+
+// TestQueryAssets runs compiled queries against a database, checking the SQL
+// is valid as well as what it matches.
+func TestQueryAssets(t *testing.T) {
+	d := newTestDatabase(t)
+	folder, err := d.AddWatchFolder(filepath.Join(t.TempDir(), "lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crate := addTestAsset(t, d, folder, "props/wooden_crate.glb", 2<<20)
+	barrel := addTestAsset(t, d, folder, "props/barrel.obj", 512)
+	chair := addTestAsset(t, d, folder, "furniture/chair.stl", 4<<20)
+	if err := d.BulkTagAssets([]int64{crate.ID, barrel.ID}, "prop/wood"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.BulkTagAssets([]int64{chair.ID}, "wip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.BulkSetFavorite([]int64{chair.ID}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", []string{"barrel.obj", "chair.stl", "wooden_crate.glb"}},
+		{"crate", []string{"wooden_crate.glb"}},
+		{"-crate", []string{"barrel.obj", "chair.stl"}},
+		{"tag:prop", []string{"barrel.obj", "wooden_crate.glb"}},
+		{"-tag:wip", []string{"barrel.obj", "wooden_crate.glb"}},
+		{"size>1MB", []string{"chair.stl", "wooden_crate.glb"}},
+		{"size>1MB -fav:yes", []string{"wooden_crate.glb"}},
+		{"ext:obj", []string{"barrel.obj"}},
+		{"folder:furniture", []string{"chair.stl"}},
+		{"name:BARREL", []string{"barrel.obj"}},
+		{"tagged:no", nil},
+		{"used:<7d", nil},
+		{"-used:<7d", []string{"barrel.obj", "chair.stl", "wooden_crate.glb"}},
+	}
+	for _, tt := range tests {
+		assets, err := d.QueryAssets(tt.q, "name", 0, 0)
+		if err != nil {
+			t.Errorf("QueryAssets(%q): %v", tt.q, err)
+			continue
+		}
+		var got []string
+		for _, a := range assets {
+			got = append(got, a.Filename)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryAssets(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+		if n, err := d.CountQueryAssets(tt.q); err != nil || n != len(tt.want) {
+			t.Errorf("CountQueryAssets(%q) = %d, %v, want %d", tt.q, n, err, len(tt.want))
+		}
+	}
+
+	if _, err := d.QueryAssets("crate", "colour", 0, 0); err == nil || !strings.Contains(err.Error(), "unknown sort") {
+		t.Errorf("unknown sort error = %v", err)
+	}
+}
+
+// pageThrough collects every asset of a listing, limit at a time.
+func pageThrough(t *testing.T, d *Database, f AssetFilter, sort string, limit int) []Asset {
+	t.Helper()
+	var all []Asset
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatalf("paging %q never ended", sort)
+		}
+		page, err := d.ListAssetsPage(f, sort, cursor, limit)
+		if err != nil {
+			t.Fatalf("ListAssetsPage(%q): %v", sort, err)
+		}
+		if len(page.Assets) > limit {
+			t.Fatalf("page of %d assets, limit %d", len(page.Assets), limit)
+		}
+		all = append(all, page.Assets...)
+		if page.NextCursor == "" {
+			return all
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func assetIDs(assets []Asset) []int64 {
+	ids := make([]int64, len(assets))
+	for i, a := range assets {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+func TestListAssetsPage(t *testing.T) {
+	d := newTestDatabase(t)
+	folder, err := d.AddWatchFolder(filepath.Join(t.TempDir(), "lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repeated names and sizes make the id tie-break matter
+	for i, name := range []string{"crate.glb", "Barrel.obj", "crate.stl", "anvil.glb", "chair.ply", "barrel.stl", "table.gltf"} {
+		addTestAsset(t, d, folder, fmt.Sprintf("%d/%s", i, name), int64(100*(i%3)))
+	}
+
+	for _, sort := range []string{"name", "-name", "file-size", "-file-size", "date-added"} {
+		want, err := d.FilterAssets(AssetFilter{}, sort, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, limit := range []int{1, 3, 7, 50} {
+			got := pageThrough(t, d, AssetFilter{}, sort, limit)
+			if !reflect.DeepEqual(assetIDs(got), assetIDs(want)) {
+				t.Errorf("sort %q, limit %d: paged %v, want %v", sort, limit, assetIDs(got), assetIDs(want))
+			}
+		}
+	}
+
+	page, err := d.ListAssetsPage(AssetFilter{Text: "ext:glb"}, "name", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Assets) != 1 || page.Assets[0].Filename != "anvil.glb" || page.NextCursor == "" {
+		t.Fatalf("first page of ext:glb = %+v", page)
+	}
+
+	// Assets added before the cursor don't shift the next page
+	addTestAsset(t, d, folder, "new/aardvark.glb", 0)
+	next, err := d.ListAssetsPage(AssetFilter{Text: "ext:glb"}, "name", page.NextCursor, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Assets) != 1 || next.Assets[0].Filename != "crate.glb" || next.NextCursor != "" {
+		t.Errorf("second page of ext:glb = %+v", next)
+	}
+
+	// Relevance pages by offset
+	got := pageThrough(t, d, AssetFilter{Text: "barrel"}, "", 1)
+	if len(got) != 2 {
+		t.Errorf("relevance paging found %d barrels, want 2", len(got))
+	}
+
+	if _, err := d.ListAssetsPage(AssetFilter{}, "-name", page.NextCursor, 1); err == nil {
+		t.Error("a cursor for another sort was accepted")
+	}
+	if _, err := d.ListAssetsPage(AssetFilter{}, "name", "not a cursor!", 1); err == nil {
+		t.Error("an invalid cursor was accepted")
+	}
+}
@@ -0,0 +1,1157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The software renderer draws glTF models without a GPU, for machines where the
+// webview has no WebGL. It aims to look like the Three.js thumbnails: same camera
+// angle, background, light rig and tone mapping.
+
+const (
+	// rasterSupersample renders at this multiple of the output size and box-filters down.
+	rasterSupersample = 2
+	// rasterMaxFile bounds how much of a model file is read into memory.
+	rasterMaxFile = 512 << 20
+	// rasterMaxTexture is the largest texture side kept after decoding; bigger
+	// textures are halved until they fit, which is plenty for a 256px preview.
+	rasterMaxTexture = 1024
+	// rasterFill is the fraction of the frame the model's silhouette fills.
+	rasterFill = 0.85
+
+	glbChunkBIN = 0x004E4942 // "BIN\0"
+)
+
+// rasterBackground matches the Three.js renderer's clear color, 0x1a1a2e.
+var rasterBackground = [3]float64{0x1a / 255.0, 0x1a / 255.0, 0x2e / 255.0}
+
+// rasterLight is a directional light: a world-space direction towards the light,
+// and an intensity.
+type rasterLight struct {
+	dir       vec3
+	intensity float64
+}
+
+// rasterLights mirror the key, fill and back lights in thumbnails.ts.
+var rasterLights = []rasterLight{
+	{vec3{5, 10, 7}.normalize(), 0.75},
+	{vec3{-5, 3, -5}.normalize(), 0.35},
+	{vec3{0, -5, -10}.normalize(), 0.2},
+}
+
+// rasterThumbnailView points from the model towards the thumbnail camera, the
+// same angle as the Three.js thumbnails.
+var rasterThumbnailView = vec3{0.7, 0.5, 0.7}.normalize()
+
+const rasterAmbient = 0.45
+
+// canRasterize reports whether the software renderer can draw a file.
+func canRasterize(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".glb", ".gltf":
+		return true
+	}
+	return false
+}
+
+// encodePNG encodes a rendered image.
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// --- Loading ---
+
+// gltfRenderDocument extends gltfDocument with the parts of the schema needed to
+// read geometry and materials. Fields declared here shadow the embedded ones.
+type gltfRenderDocument struct {
+	gltfDocument
+	Meshes []struct {
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Mode       *int           `json:"mode"`
+			Material   *int           `json:"material"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		BufferView    *int   `json:"bufferView"`
+		ByteOffset    int    `json:"byteOffset"`
+		ComponentType int    `json:"componentType"`
+		Normalized    bool   `json:"normalized"`
+		Count         int    `json:"count"`
+		Type          string `json:"type"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+	Materials []struct {
+		PBR struct {
+			BaseColorFactor  []float64    `json:"baseColorFactor"`
+			BaseColorTexture *gltfTexInfo `json:"baseColorTexture"`
+		} `json:"pbrMetallicRoughness"`
+		EmissiveFactor []float64                  `json:"emissiveFactor"`
+		AlphaMode      string                     `json:"alphaMode"`
+		AlphaCutoff    *float64                   `json:"alphaCutoff"`
+		Extensions     map[string]json.RawMessage `json:"extensions"`
+	} `json:"materials"`
+	Textures []struct {
+		Sampler *int `json:"sampler"`
+		Source  *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		URI        string `json:"uri"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Samplers []struct {
+		WrapS *int `json:"wrapS"`
+		WrapT *int `json:"wrapT"`
+	} `json:"samplers"`
+}
+
+type gltfTexInfo struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+}
+
+// glTF accessor component types.
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+)
+
+// glTF sampler wrap modes.
+const (
+	gltfClampToEdge    = 33071
+	gltfMirroredRepeat = 33648
+)
+
+// maxZeroAccessor caps the element count of an accessor without a buffer view,
+// which is all zeros and so not bounded by the size of the file.
+const maxZeroAccessor = 1 << 20
+
+var gltfTypeComponents = map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT4": 16}
+
+// gltfLoader resolves a document's buffers and images.
+type gltfLoader struct {
+	doc     gltfRenderDocument
+	dir     string
+	bin     []byte // GLB binary chunk
+	buffers map[int][]byte
+	images  map[int]*rasterTexture
+}
+
+// rasterScene is a model flattened to world-space triangles, ready to draw.
+type rasterScene struct {
+	prims []*rasterPrim
+}
+
+// rasterPrim is one drawn primitive instance. Per-vertex slices are flat; normals,
+// uvs and colors are nil when the primitive doesn't have them.
+type rasterPrim struct {
+	pos   []vec3
+	norm  []vec3
+	uv    [][2]float64
+	color [][4]float64
+	idx   []uint32 // triangle list
+	mat   *rasterMaterial
+}
+
+type rasterMaterial struct {
+	color    [4]float64 // linear base color factor
+	emissive vec3
+	tex      *rasterTexture
+	texCoord int
+	wrapS    int
+	wrapT    int
+	cutoff   float64 // fragments with alpha below this are discarded
+	unlit    bool
+}
+
+var defaultRasterMaterial = &rasterMaterial{color: [4]float64{1, 1, 1, 1}, cutoff: -1}
+
+func loadRasterScene(path string) (*rasterScene, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, rasterMaxFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > rasterMaxFile {
+		return nil, fmt.Errorf("file larger than %d MB", rasterMaxFile>>20)
+	}
+
+	l := &gltfLoader{dir: filepath.Dir(path), buffers: map[int][]byte{}, images: map[int]*rasterTexture{}}
+	raw := data
+	if strings.ToLower(filepath.Ext(path)) == ".glb" {
+		if raw, l.bin, err = splitGLB(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(raw, &l.doc); err != nil {
+		return nil, fmt.Errorf("parse gltf json: %w", err)
+	}
+	if !strings.HasPrefix(l.doc.Asset.Version, "2") {
+		return nil, fmt.Errorf("unsupported gltf version %q", l.doc.Asset.Version)
+	}
+	return l.scene()
+}
+
+// splitGLB returns the JSON and binary chunks of a GLB container.
+func splitGLB(data []byte) (jsonChunk, bin []byte, err error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data) != glbMagic {
+		return nil, nil, errors.New("not a glb file")
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != 2 {
+		return nil, nil, fmt.Errorf("unsupported glb version %d", v)
+	}
+	for off := 12; off+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[off:]))
+		kind := binary.LittleEndian.Uint32(data[off+4:])
+		start := off + 8
+		if length < 0 || start+length > len(data) {
+			return nil, nil, errors.New("truncated glb chunk")
+		}
+		switch kind {
+		case glbChunkJSON:
+			jsonChunk = data[start : start+length]
+		case glbChunkBIN:
+			if bin == nil {
+				bin = data[start : start+length]
+			}
+		}
+		off = start + length
+	}
+	if jsonChunk == nil {
+		return nil, nil, errors.New("glb has no JSON chunk")
+	}
+	return jsonChunk, bin, nil
+}
+
+// resource loads a buffer or image URI: a data: URI, or a file beside the model.
+func (l *gltfLoader) resource(uri string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(uri, "data:"); ok {
+		meta, payload, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, errors.New("unsupported data URI")
+		}
+		return base64.StdEncoding.DecodeString(payload)
+	}
+	rel, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+	p := filepath.Join(l.dir, filepath.FromSlash(rel))
+	if !isWithinDir(l.dir, p) {
+		return nil, fmt.Errorf("resource %q is outside the model's folder", uri)
+	}
+	return os.ReadFile(p)
+}
+
+func (l *gltfLoader) buffer(i int) ([]byte, error) {
+	if b, ok := l.buffers[i]; ok {
+		return b, nil
+	}
+	if i < 0 || i >= len(l.doc.Buffers) {
+		return nil, fmt.Errorf("buffer %d out of range", i)
+	}
+	var b []byte
+	if uri := l.doc.Buffers[i].URI; uri != "" {
+		var err error
+		if b, err = l.resource(uri); err != nil {
+			return nil, fmt.Errorf("buffer %d: %w", i, err)
+		}
+	} else if i == 0 && l.bin != nil {
+		b = l.bin
+	} else {
+		return nil, fmt.Errorf("buffer %d has no data", i)
+	}
+	l.buffers[i] = b
+	return b, nil
+}
+
+func (l *gltfLoader) bufferView(i int) ([]byte, int, error) {
+	if i < 0 || i >= len(l.doc.BufferViews) {
+		return nil, 0, fmt.Errorf("buffer view %d out of range", i)
+	}
+	v := l.doc.BufferViews[i]
+	b, err := l.buffer(v.Buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v.ByteOffset < 0 || v.ByteLength < 0 || v.ByteOffset > len(b) || v.ByteLength > len(b)-v.ByteOffset {
+		return nil, 0, fmt.Errorf("buffer view %d out of bounds", i)
+	}
+	return b[v.ByteOffset : v.ByteOffset+v.ByteLength], v.ByteStride, nil
+}
+
+// accessor reads an accessor as float64s, comps per element. Normalized integer
+// components are mapped to [0, 1] or [-1, 1].
+func (l *gltfLoader) accessor(i int) (vals []float64, comps int, err error) {
+	if i < 0 || i >= len(l.doc.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %d out of range", i)
+	}
+	a := l.doc.Accessors[i]
+	comps = gltfTypeComponents[a.Type]
+	if comps == 0 {
+		return nil, 0, fmt.Errorf("accessor %d has unsupported type %q", i, a.Type)
+	}
+	var size int
+	switch a.ComponentType {
+	case gltfByte, gltfUnsignedByte:
+		size = 1
+	case gltfShort, gltfUnsignedShort:
+		size = 2
+	case gltfUnsignedInt, gltfFloat:
+		size = 4
+	default:
+		return nil, 0, fmt.Errorf("accessor %d has unsupported component type %d", i, a.ComponentType)
+	}
+	if a.Count < 0 {
+		return nil, 0, fmt.Errorf("accessor %d has negative count", i)
+	}
+	if a.BufferView == nil {
+		if a.Count > maxZeroAccessor {
+			return nil, 0, fmt.Errorf("accessor %d is too large", i)
+		}
+		return make([]float64, a.Count*comps), comps, nil // all zeros, per the spec
+	}
+	view, stride, err := l.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, 0, err
+	}
+	elem := size * comps
+	if a.ByteOffset < 0 || stride < 0 || (stride != 0 && stride < elem) {
+		return nil, 0, fmt.Errorf("accessor %d has a bad byte offset or stride", i)
+	}
+	if stride == 0 {
+		stride = elem
+	}
+	// Compare by division so a huge count can't overflow the bounds check
+	if room := len(view) - a.ByteOffset - elem; a.ByteOffset > len(view) || a.Count > 0 && (room < 0 || a.Count-1 > room/stride) {
+		return nil, 0, fmt.Errorf("accessor %d out of bounds", i)
+	}
+	vals = make([]float64, a.Count*comps)
+	for e := 0; e < a.Count; e++ {
+		base := a.ByteOffset + e*stride
+		for c := 0; c < comps; c++ {
+			p := view[base+c*size:]
+			var v float64
+			switch a.ComponentType {
+			case gltfByte:
+				v = float64(int8(p[0]))
+				if a.Normalized {
+					v = math.Max(v/127, -1)
+				}
+			case gltfUnsignedByte:
+				v = float64(p[0])
+				if a.Normalized {
+					v /= 255
+				}
+			case gltfShort:
+				v = float64(int16(binary.LittleEndian.Uint16(p)))
+				if a.Normalized {
+					v = math.Max(v/32767, -1)
+				}
+			case gltfUnsignedShort:
+				v = float64(binary.LittleEndian.Uint16(p))
+				if a.Normalized {
+					v /= 65535
+				}
+			case gltfUnsignedInt:
+				v = float64(binary.LittleEndian.Uint32(p))
+			case gltfFloat:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(p)))
+			}
+			vals[e*comps+c] = v
+		}
+	}
+	return vals, comps, nil
+}
+
+// scene walks the default scene and flattens every mesh instance into world space.
+func (l *gltfLoader) scene() (*rasterScene, error) {
+	s := &rasterScene{}
+	materials := make(map[int]*rasterMaterial)
+	var firstErr error
+
+	instanced := false
+	var visit func(node int, parent mat4, depth int)
+	visit = func(node int, parent mat4, depth int) {
+		if node < 0 || node >= len(l.doc.Nodes) || depth > len(l.doc.Nodes) {
+			return
+		}
+		n := l.doc.Nodes[node]
+		world := parent.mul(nodeMatrix(n.Matrix, n.Translation, n.Rotation, n.Scale))
+		if n.Mesh != nil {
+			instanced = true
+			if err := l.addMesh(s, materials, *n.Mesh, world); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		for _, c := range n.Children {
+			visit(c, world, depth+1)
+		}
+	}
+	for _, root := range l.doc.sceneRoots() {
+		visit(root, identity(), 0)
+	}
+	if !instanced {
+		for i := range l.doc.Meshes {
+			if err := l.addMesh(s, materials, i, identity()); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	// A partly broken file still gets a preview of whatever could be read
+	if len(s.prims) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return s, nil
+}
+
+func (l *gltfLoader) addMesh(s *rasterScene, materials map[int]*rasterMaterial, mesh int, world mat4) error {
+	if mesh < 0 || mesh >= len(l.doc.Meshes) {
+		return nil
+	}
+	normalMat := world.normalMatrix()
+	for _, p := range l.doc.Meshes[mesh].Primitives {
+		mode := gltfModeTriangles
+		if p.Mode != nil {
+			mode = *p.Mode
+		}
+		if mode != gltfModeTriangles && mode != gltfModeTriangleStrip && mode != gltfModeTriangleFan {
+			continue // points and lines don't show up in a thumbnail
+		}
+		posAcc, ok := p.Attributes["POSITION"]
+		if !ok {
+			continue
+		}
+		pos, comps, err := l.accessor(posAcc)
+		if err != nil {
+			return err
+		}
+		if comps != 3 {
+			continue
+		}
+		count := len(pos) / 3
+
+		prim := &rasterPrim{pos: make([]vec3, count), mat: defaultRasterMaterial}
+		for i := range prim.pos {
+			x, y, z := world.transformPoint(pos[i*3], pos[i*3+1], pos[i*3+2])
+			prim.pos[i] = vec3{x, y, z}
+		}
+
+		if a, ok := p.Attributes["NORMAL"]; ok {
+			if n, c, err := l.accessor(a); err == nil && c == 3 && len(n) == count*3 {
+				prim.norm = make([]vec3, count)
+				for i := range prim.norm {
+					prim.norm[i] = normalMat.transformDir(vec3{n[i*3], n[i*3+1], n[i*3+2]}).normalize()
+				}
+			}
+		}
+		if a, ok := p.Attributes["COLOR_0"]; ok {
+			if c, cc, err := l.accessor(a); err == nil && (cc == 3 || cc == 4) && len(c) == count*cc {
+				prim.color = make([][4]float64, count)
+				for i := range prim.color {
+					col := [4]float64{c[i*cc], c[i*cc+1], c[i*cc+2], 1}
+					if cc == 4 {
+						col[3] = c[i*cc+3]
+					}
+					prim.color[i] = col
+				}
+			}
+		}
+
+		if p.Material != nil {
+			prim.mat = l.material(materials, *p.Material)
+		}
+		if prim.mat.tex != nil {
+			attr := fmt.Sprintf("TEXCOORD_%d", prim.mat.texCoord)
+			if a, ok := p.Attributes[attr]; ok {
+				if uv, c, err := l.accessor(a); err == nil && c == 2 && len(uv) == count*2 {
+					prim.uv = make([][2]float64, count)
+					for i := range prim.uv {
+						prim.uv[i] = [2]float64{uv[i*2], uv[i*2+1]}
+					}
+				}
+			}
+		}
+
+		var indices []uint32
+		if p.Indices != nil {
+			idx, _, err := l.accessor(*p.Indices)
+			if err != nil {
+				return err
+			}
+			indices = make([]uint32, len(idx))
+			for i, v := range idx {
+				indices[i] = uint32(v)
+			}
+		} else {
+			indices = make([]uint32, count)
+			for i := range indices {
+				indices[i] = uint32(i)
+			}
+		}
+		prim.idx = triangleList(indices, mode, uint32(count))
+		if len(prim.idx) > 0 {
+			s.prims = append(s.prims, prim)
+		}
+	}
+	return nil
+}
+
+// triangleList converts strip and fan indices to a plain list, dropping any
+// triangle that refers to a vertex that doesn't exist.
+func triangleList(idx []uint32, mode int, vertices uint32) []uint32 {
+	var out []uint32
+	add := func(a, b, c uint32) {
+		if a < vertices && b < vertices && c < vertices {
+			out = append(out, a, b, c)
+		}
+	}
+	switch mode {
+	case gltfModeTriangles:
+		out = make([]uint32, 0, len(idx)/3*3)
+		for i := 0; i+2 < len(idx); i += 3 {
+			add(idx[i], idx[i+1], idx[i+2])
+		}
+	case gltfModeTriangleStrip:
+		for i := 0; i+2 < len(idx); i++ {
+			if i%2 == 0 {
+				add(idx[i], idx[i+1], idx[i+2])
+			} else {
+				add(idx[i+1], idx[i], idx[i+2])
+			}
+		}
+	case gltfModeTriangleFan:
+		for i := 1; i+1 < len(idx); i++ {
+			add(idx[0], idx[i], idx[i+1])
+		}
+	}
+	return out
+}
+
+func (l *gltfLoader) material(cache map[int]*rasterMaterial, i int) *rasterMaterial {
+	if m, ok := cache[i]; ok {
+		return m
+	}
+	if i < 0 || i >= len(l.doc.Materials) {
+		return defaultRasterMaterial
+	}
+	src := l.doc.Materials[i]
+	m := &rasterMaterial{color: [4]float64{1, 1, 1, 1}, cutoff: -1}
+	if f := src.PBR.BaseColorFactor; len(f) == 4 {
+		copy(m.color[:], f)
+	}
+	if f := src.EmissiveFactor; len(f) == 3 {
+		m.emissive = vec3{f[0], f[1], f[2]}
+	}
+	if src.AlphaMode == "MASK" {
+		m.cutoff = 0.5
+		if src.AlphaCutoff != nil {
+			m.cutoff = *src.AlphaCutoff
+		}
+	}
+	_, m.unlit = src.Extensions["KHR_materials_unlit"]
+
+	if t := src.PBR.BaseColorTexture; t != nil && t.Index >= 0 && t.Index < len(l.doc.Textures) {
+		tex := l.doc.Textures[t.Index]
+		if tex.Source != nil {
+			img, err := l.image(*tex.Source)
+			if err != nil {
+				fmt.Printf("[raster] warn: texture %d: %v\n", t.Index, err)
+			}
+			m.tex = img
+		}
+		m.texCoord = t.TexCoord
+		if tex.Sampler != nil && *tex.Sampler >= 0 && *tex.Sampler < len(l.doc.Samplers) {
+			s := l.doc.Samplers[*tex.Sampler]
+			if s.WrapS != nil {
+				m.wrapS = *s.WrapS
+			}
+			if s.WrapT != nil {
+				m.wrapT = *s.WrapT
+			}
+		}
+	}
+	cache[i] = m
+	return m
+}
+
+// image decodes a PNG or JPEG image. Other formats (WebP, KTX2) aren't supported,
+// and the material falls back to its base color factor.
+func (l *gltfLoader) image(i int) (*rasterTexture, error) {
+	if t, ok := l.images[i]; ok {
+		return t, nil
+	}
+	if i < 0 || i >= len(l.doc.Images) {
+		return nil, fmt.Errorf("image %d out of range", i)
+	}
+	l.images[i] = nil // don't retry a broken image for every material using it
+
+	src := l.doc.Images[i]
+	var data []byte
+	var err error
+	switch {
+	case src.BufferView != nil:
+		data, _, err = l.bufferView(*src.BufferView)
+	case src.URI != "":
+		data, err = l.resource(src.URI)
+	default:
+		err = errors.New("image has no data")
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	t := newRasterTexture(img)
+	l.images[i] = t
+	return t, nil
+}
+
+// --- Textures ---
+
+// rasterTexture is an 8-bit sRGB image sampled bilinearly in linear space.
+type rasterTexture struct {
+	w, h int
+	pix  []uint8 // RGBA, non-premultiplied
+}
+
+func newRasterTexture(src image.Image) *rasterTexture {
+	b := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	t := &rasterTexture{w: b.Dx(), h: b.Dy(), pix: img.Pix}
+	for (t.w > rasterMaxTexture || t.h > rasterMaxTexture) && t.w > 1 && t.h > 1 {
+		t = t.half()
+	}
+	return t
+}
+
+// half box-filters the texture to half its size.
+func (t *rasterTexture) half() *rasterTexture {
+	h := &rasterTexture{w: t.w / 2, h: t.h / 2}
+	h.pix = make([]uint8, h.w*h.h*4)
+	for y := 0; y < h.h; y++ {
+		for x := 0; x < h.w; x++ {
+			for c := 0; c < 4; c++ {
+				sum := int(t.pix[((2*y)*t.w+2*x)*4+c]) + int(t.pix[((2*y)*t.w+2*x+1)*4+c]) +
+					int(t.pix[((2*y+1)*t.w+2*x)*4+c]) + int(t.pix[((2*y+1)*t.w+2*x+1)*4+c])
+				h.pix[(y*h.w+x)*4+c] = uint8((sum + 2) / 4)
+			}
+		}
+	}
+	return h
+}
+
+// srgbToLinear maps 8-bit sRGB values to linear intensity.
+var srgbToLinear = func() (lut [256]float64) {
+	for i := range lut {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			lut[i] = c / 12.92
+		} else {
+			lut[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return lut
+}()
+
+func wrapCoord(v float64, size int, mode int) int {
+	i := int(math.Floor(v))
+	switch mode {
+	case gltfClampToEdge:
+		return min(max(i, 0), size-1)
+	case gltfMirroredRepeat:
+		period := 2 * size
+		i = ((i % period) + period) % period
+		if i >= size {
+			i = period - 1 - i
+		}
+		return i
+	default:
+		return ((i % size) + size) % size
+	}
+}
+
+// sample returns the linear color at uv.
+func (t *rasterTexture) sample(u, v float64, wrapS, wrapT int) [4]float64 {
+	x := u*float64(t.w) - 0.5
+	y := v*float64(t.h) - 0.5
+	fx, fy := x-math.Floor(x), y-math.Floor(y)
+	x0, x1 := wrapCoord(x, t.w, wrapS), wrapCoord(x+1, t.w, wrapS)
+	y0, y1 := wrapCoord(y, t.h, wrapT), wrapCoord(y+1, t.h, wrapT)
+
+	var out [4]float64
+	for c := 0; c < 4; c++ {
+		texel := func(x, y int) float64 {
+			p := t.pix[(y*t.w+x)*4+c]
+			if c == 3 {
+				return float64(p) / 255
+			}
+			return srgbToLinear[p]
+		}
+		top := texel(x0, y0)*(1-fx) + texel(x1, y0)*fx
+		bottom := texel(x0, y1)*(1-fx) + texel(x1, y1)*fx
+		out[c] = top*(1-fy) + bottom*fy
+	}
+	return out
+}
+
+// --- Drawing ---
+
+// rasterCamera is a perspective (45° field of view) or orthographic view.
+type rasterCamera struct {
+	eye            vec3
+	right, up, fwd vec3
+	ortho          bool
+	// Projected coordinates are (x/w - shift) * scale (x - shift for orthographic
+	// views), which lets fitLens center the silhouette exactly.
+	shiftX, shiftY float64
+	scale          float64
+	// lights are the directional lights in world space. Turntable frames turn them
+	// with the camera, so the model looks like it spins under a fixed rig.
+	lights []rasterLight
+}
+
+// lookAlong returns a camera looking down -back, with worldUp pointing up the frame.
+// The eye is at the origin until the caller places it.
+func lookAlong(back, worldUp vec3) rasterCamera {
+	right := worldUp.cross(back).normalize()
+	return rasterCamera{
+		right:  right,
+		up:     back.cross(right),
+		fwd:    back.scale(-1),
+		scale:  1,
+		lights: rasterLights,
+	}
+}
+
+// project returns a world-space point's normalized device coordinates and its
+// distance in front of the camera.
+func (c *rasterCamera) project(v vec3) (x, y, w float64) {
+	rel := v.sub(c.eye)
+	w = rel.dot(c.fwd)
+	if c.ortho {
+		return (rel.dot(c.right) - c.shiftX) * c.scale, (rel.dot(c.up) - c.shiftY) * c.scale, w
+	}
+	if w <= 0 {
+		w = 1e-9
+	}
+	return (rel.dot(c.right)/w - c.shiftX) * c.scale, (rel.dot(c.up)/w - c.shiftY) * c.scale, w
+}
+
+// fitLens shifts and zooms the lens so the silhouette is centered and fills
+// rasterFill of the frame.
+func (s *rasterScene) fitLens(cam *rasterCamera) {
+	cam.shiftX, cam.shiftY, cam.scale = 0, 0, 1
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, p := range s.prims {
+		for _, v := range p.pos {
+			x, y, _ := cam.project(v)
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		}
+	}
+	cam.shiftX, cam.shiftY = (minX+maxX)/2, (minY+maxY)/2
+	if halfExtent := math.Max(maxX-minX, maxY-minY) / 2; halfExtent > 0 {
+		cam.scale = rasterFill / halfExtent
+	}
+}
+
+// sphere returns the center of the scene's bounding box and the distance from it
+// to the farthest vertex.
+func (s *rasterScene) sphere() (vec3, float64) {
+	b := newBounds()
+	for _, p := range s.prims {
+		for _, v := range p.pos {
+			b.addPoint(v[0], v[1], v[2])
+		}
+	}
+	center := vec3{(b.min[0] + b.max[0]) / 2, (b.min[1] + b.max[1]) / 2, (b.min[2] + b.max[2]) / 2}
+	radius := 0.0
+	for _, p := range s.prims {
+		for _, v := range p.pos {
+			d := v.sub(center)
+			radius = math.Max(radius, d.dot(d))
+		}
+	}
+	radius = math.Sqrt(radius)
+	if radius == 0 {
+		radius = 1
+	}
+	return center, radius
+}
+
+// thumbnailCamera looks along rasterThumbnailView from far enough back to see the
+// whole model, with the lens fitted to its silhouette.
+func (s *rasterScene) thumbnailCamera() rasterCamera {
+	cam := lookAlong(rasterThumbnailView, vec3{0, 1, 0})
+	back := rasterThumbnailView
+	tanHalf := math.Tan(math.Pi / 8)
+
+	// Extents in the camera's view plane, and depth along the view axis
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, p := range s.prims {
+		for _, v := range p.pos {
+			x, y := v.dot(cam.right), v.dot(cam.up)
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		}
+	}
+	cx, cy := (minX+maxX)/2, (minY+maxY)/2
+
+	// Each vertex needs the eye far enough back that it projects inside the frame:
+	// |x - cx| / (dist - z) <= tanHalf
+	dist := math.Inf(-1)
+	maxZ := math.Inf(-1)
+	for _, p := range s.prims {
+		for _, v := range p.pos {
+			z := v.dot(back)
+			off := math.Max(math.Abs(v.dot(cam.right)-cx), math.Abs(v.dot(cam.up)-cy))
+			dist = math.Max(dist, z+off/tanHalf)
+			maxZ = math.Max(maxZ, z)
+		}
+	}
+	extent := math.Max(maxX-minX, maxY-minY)
+	if extent <= 0 {
+		extent = 1
+	}
+	dist = math.Max(dist, maxZ+extent*0.01)
+
+	cam.eye = cam.right.scale(cx).add(cam.up.scale(cy)).add(back.scale(dist))
+	s.fitLens(&cam)
+	return cam
+}
+
+// turntableCamera orbits the thumbnail camera angle radians around the vertical
+// axis. Every frame frames the same bounding sphere, so the model doesn't change
+// size as it turns.
+func (s *rasterScene) turntableCamera(angle float64) rasterCamera {
+	spin := func(v vec3) vec3 {
+		sin, cos := math.Sincos(angle)
+		return vec3{v[0]*cos + v[2]*sin, v[1], -v[0]*sin + v[2]*cos}
+	}
+	back := spin(rasterThumbnailView)
+	cam := lookAlong(back, vec3{0, 1, 0})
+	cam.lights = make([]rasterLight, len(rasterLights))
+	for i, l := range rasterLights {
+		cam.lights[i] = rasterLight{spin(l.dir), l.intensity}
+	}
+
+	center, radius := s.sphere()
+	cam.eye = center.add(back.scale(radius / math.Sin(math.Pi/8)))
+	cam.scale = rasterFill / math.Tan(math.Pi/8)
+	return cam
+}
+
+// orthoCamera looks at the model down -back without perspective.
+func (s *rasterScene) orthoCamera(back, worldUp vec3) rasterCamera {
+	cam := lookAlong(back, worldUp)
+	cam.ortho = true
+	center, radius := s.sphere()
+	cam.eye = center.add(back.scale(radius * 2))
+	s.fitLens(&cam)
+	return cam
+}
+
+// thumbnail renders the main preview.
+func (s *rasterScene) thumbnail(size int) *image.NRGBA {
+	return s.render(s.thumbnailCamera(), size)
+}
+
+// turntable renders frames views evenly spaced around the model, left to right
+// in one strip, starting from the thumbnail's angle.
+func (s *rasterScene) turntable(size, frames int) *image.NRGBA {
+	views := make([]rasterCamera, frames)
+	for i := range views {
+		views[i] = s.turntableCamera(2 * math.Pi * float64(i) / float64(frames))
+	}
+	return s.strip(size, views)
+}
+
+// orthoViews renders front, side (from +X) and top orthographic views in one strip.
+func (s *rasterScene) orthoViews(size int) *image.NRGBA {
+	return s.strip(size, []rasterCamera{
+		s.orthoCamera(vec3{0, 0, 1}, vec3{0, 1, 0}),
+		s.orthoCamera(vec3{1, 0, 0}, vec3{0, 1, 0}),
+		s.orthoCamera(vec3{0, 1, 0}, vec3{0, 0, -1}),
+	})
+}
+
+// strip renders each camera into consecutive size×size cells of one image.
+func (s *rasterScene) strip(size int, cams []rasterCamera) *image.NRGBA {
+	sheet := image.NewNRGBA(image.Rect(0, 0, size*len(cams), size))
+	for i, cam := range cams {
+		cell := image.Rect(i*size, 0, (i+1)*size, size)
+		draw.Draw(sheet, cell, s.render(cam, size), image.Point{}, draw.Src)
+	}
+	return sheet
+}
+
+// render draws the scene through cam and returns a size×size image.
+func (s *rasterScene) render(cam rasterCamera, size int) *image.NRGBA {
+	n := size * rasterSupersample
+	half := float64(n) / 2
+
+	pixels := make([]vec3, n*n)
+	for i := range pixels {
+		pixels[i] = vec3{srgbDecode(rasterBackground[0]), srgbDecode(rasterBackground[1]), srgbDecode(rasterBackground[2])}
+	}
+	// Larger depth values are nearer: 1/w in perspective, -w in orthographic views
+	depth := make([]float64, n*n)
+	for i := range depth {
+		depth[i] = math.Inf(-1)
+	}
+
+	type screenVertex struct {
+		x, y  float64
+		invW  float64 // for perspective-correct interpolation; 1 when orthographic
+		depth float64
+	}
+	for _, p := range s.prims {
+		sv := make([]screenVertex, len(p.pos))
+		for i, v := range p.pos {
+			x, y, w := cam.project(v)
+			v := screenVertex{x: half + x*half, y: half - y*half, invW: 1 / w, depth: 1 / w}
+			if cam.ortho {
+				v.invW, v.depth = 1, -w
+			}
+			sv[i] = v
+		}
+
+		for t := 0; t+2 < len(p.idx); t += 3 {
+			i0, i1, i2 := p.idx[t], p.idx[t+1], p.idx[t+2]
+			a, b, c := sv[i0], sv[i1], sv[i2]
+			area := (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+			if area == 0 || math.IsNaN(area) {
+				continue
+			}
+			faceN := p.pos[i1].sub(p.pos[i0]).cross(p.pos[i2].sub(p.pos[i0])).normalize()
+
+			x0 := max(int(math.Floor(min(a.x, b.x, c.x))), 0)
+			x1 := min(int(math.Ceil(max(a.x, b.x, c.x))), n-1)
+			y0 := max(int(math.Floor(min(a.y, b.y, c.y))), 0)
+			y1 := min(int(math.Ceil(max(a.y, b.y, c.y))), n-1)
+			for py := y0; py <= y1; py++ {
+				fy := float64(py) + 0.5
+				for px := x0; px <= x1; px++ {
+					fx := float64(px) + 0.5
+					w0 := ((b.x-fx)*(c.y-fy) - (b.y-fy)*(c.x-fx)) / area
+					w1 := ((c.x-fx)*(a.y-fy) - (c.y-fy)*(a.x-fx)) / area
+					w2 := 1 - w0 - w1
+					if w0 < 0 || w1 < 0 || w2 < 0 {
+						continue
+					}
+					z := w0*a.depth + w1*b.depth + w2*c.depth
+					at := py*n + px
+					if z <= depth[at] {
+						continue
+					}
+					// Perspective-correct barycentrics for attribute interpolation
+					invW := w0*a.invW + w1*b.invW + w2*c.invW
+					b0, b1, b2 := w0*a.invW/invW, w1*b.invW/invW, w2*c.invW/invW
+					rgb, ok := p.shade(i0, i1, i2, b0, b1, b2, faceN, &cam)
+					if !ok {
+						continue
+					}
+					depth[at] = z
+					pixels[at] = rgb
+				}
+			}
+		}
+	}
+
+	// Box-filter down to the output size and encode to sRGB
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	ss := rasterSupersample
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var sum vec3
+			for dy := 0; dy < ss; dy++ {
+				for dx := 0; dx < ss; dx++ {
+					sum = sum.add(pixels[(y*ss+dy)*n+x*ss+dx])
+				}
+			}
+			sum = sum.scale(1 / float64(ss*ss))
+			img.SetNRGBA(x, y, rgbaFromLinear(sum))
+		}
+	}
+	return img
+}
+
+// shade computes the tone-mapped linear color of a fragment, or false if the
+// material's alpha cutoff discards it.
+func (p *rasterPrim) shade(i0, i1, i2 uint32, b0, b1, b2 float64, faceN vec3, cam *rasterCamera) (vec3, bool) {
+	m := p.mat
+	base := m.color
+	if p.color != nil {
+		c0, c1, c2 := p.color[i0], p.color[i1], p.color[i2]
+		for k := 0; k < 4; k++ {
+			base[k] *= c0[k]*b0 + c1[k]*b1 + c2[k]*b2
+		}
+	}
+	if m.tex != nil && p.uv != nil {
+		u := p.uv[i0][0]*b0 + p.uv[i1][0]*b1 + p.uv[i2][0]*b2
+		v := p.uv[i0][1]*b0 + p.uv[i1][1]*b1 + p.uv[i2][1]*b2
+		texel := m.tex.sample(u, v, m.wrapS, m.wrapT)
+		for k := 0; k < 4; k++ {
+			base[k] *= texel[k]
+		}
+	}
+	if base[3] < m.cutoff {
+		return vec3{}, false
+	}
+	albedo := vec3{base[0], base[1], base[2]}
+	if m.unlit {
+		return albedo, true
+	}
+
+	normal := faceN
+	if p.norm != nil {
+		normal = p.norm[i0].scale(b0).add(p.norm[i1].scale(b1)).add(p.norm[i2].scale(b2)).normalize()
+	}
+	// Light both sides of a surface: flip normals that face away from the camera
+	if normal.dot(cam.fwd) > 0 {
+		normal = normal.scale(-1)
+	}
+	light := rasterAmbient
+	for _, l := range cam.lights {
+		light += l.intensity * math.Max(0, normal.dot(l.dir))
+	}
+	return neutralToneMap(albedo.scale(light).add(m.emissive)), true
+}
+
+// neutralToneMap is the Khronos PBR Neutral operator, as used by Three.js.
+func neutralToneMap(c vec3) vec3 {
+	const startCompression = 0.8 - 0.04
+	const desaturation = 0.15
+
+	x := min(c[0], c[1], c[2])
+	offset := 0.04
+	if x < 0.08 {
+		offset = x - 6.25*x*x
+	}
+	c = c.add(vec3{-offset, -offset, -offset})
+
+	peak := max(c[0], c[1], c[2])
+	if peak < startCompression {
+		return c
+	}
+	const d = 1 - startCompression
+	newPeak := 1 - d*d/(peak+d-startCompression)
+	c = c.scale(newPeak / peak)
+	g := 1 - 1/(desaturation*(peak-newPeak)+1)
+	return c.scale(1 - g).add(vec3{newPeak, newPeak, newPeak}.scale(g))
+}
+
+func srgbDecode(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func srgbEncode(c float64) float64 {
+	c = math.Min(math.Max(c, 0), 1)
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+func rgbaFromLinear(c vec3) color.NRGBA {
+	return color.NRGBA{
+		R: uint8(math.Round(srgbEncode(c[0]) * 255)),
+		G: uint8(math.Round(srgbEncode(c[1]) * 255)),
+		B: uint8(math.Round(srgbEncode(c[2]) * 255)),
+		A: 255,
+	}
+}
+
+// --- Vector math ---
+
+type vec3 [3]float64
+
+func (a vec3) add(b vec3) vec3      { return vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a vec3) sub(b vec3) vec3      { return vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a vec3) scale(s float64) vec3 { return vec3{a[0] * s, a[1] * s, a[2] * s} }
+func (a vec3) dot(b vec3) float64   { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func (a vec3) normalize() vec3 {
+	l := math.Sqrt(a.dot(a))
+	if l == 0 {
+		return a
+	}
+	return a.scale(1 / l)
+}
+
+// normalMatrix returns the inverse transpose of the upper 3x3 of m, for
+// transforming normals under non-uniform scale. Singular matrices fall back to m.
+func (m mat4) normalMatrix() mat4 {
+	a, b, c := m[0], m[4], m[8]
+	d, e, f := m[1], m[5], m[9]
+	g, h, i := m[2], m[6], m[10]
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	if det == 0 {
+		return m
+	}
+	inv := 1 / det
+	// Column-major inverse transpose = cofactor matrix / det
+	return mat4{
+		(e*i - f*h) * inv, (c*h - b*i) * inv, (b*f - c*e) * inv, 0,
+		(f*g - d*i) * inv, (a*i - c*g) * inv, (c*d - a*f) * inv, 0,
+		(d*h - e*g) * inv, (b*g - a*h) * inv, (a*e - b*d) * inv, 0,
+		0, 0, 0, 1,
+	}
+}
+
+func (m mat4) transformDir(v vec3) vec3 {
+	return vec3{
+		m[0]*v[0] + m[4]*v[1] + m[8]*v[2],
+		m[1]*v[0] + m[5]*v[1] + m[9]*v[2],
+		m[2]*v[0] + m[6]*v[1] + m[10]*v[2],
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// accessorLoader returns a loader for a document with one 24-byte buffer
+// holding the floats 1–6, one view over all of it, and the given accessor.
+func accessorLoader(t *testing.T, view, accessor string) *gltfLoader {
+	t.Helper()
+	const data = "data:application/octet-stream;base64,AACAPwAAAEAAAEBAAACAQAAAoEAAAMBA"
+	doc := fmt.Sprintf(`{
+		"buffers": [{"uri": %q, "byteLength": 24}],
+		"bufferViews": [%s],
+		"accessors": [%s]
+	}`, data, view, accessor)
+	l := &gltfLoader{buffers: make(map[int][]byte)}
+	if err := json.Unmarshal([]byte(doc), &l.doc); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestGLTFAccessor(t *testing.T) {
+	const view = `{"buffer": 0, "byteLength": 24}`
+	tests := []struct {
+		name     string
+		view     string
+		accessor string
+		want     []float64
+		wantErr  bool
+	}{
+		{
+			name:     "vec3",
+			view:     view,
+			accessor: `{"bufferView": 0, "componentType": 5126, "count": 2, "type": "VEC3"}`,
+			want:     []float64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:     "offset",
+			view:     view,
+			accessor: `{"bufferView": 0, "byteOffset": 12, "componentType": 5126, "count": 3, "type": "SCALAR"}`,
+			want:     []float64{4, 5, 6},
+		},
+		{
+			name:     "stride",
+			view:     `{"buffer": 0, "byteLength": 24, "byteStride": 8}`,
+			accessor: `{"bufferView": 0, "componentType": 5126, "count": 3, "type": "SCALAR"}`,
+			want:     []float64{1, 3, 5},
+		},
+		{
+			name:     "no buffer view",
+			view:     view,
+			accessor: `{"componentType": 5126, "count": 2, "type": "VEC2"}`,
+			want:     []float64{0, 0, 0, 0},
+		},
+		{
+			name:     "negative byte offset",
+			view:     view,
+			accessor: `{"bufferView": 0, "byteOffset": -4, "componentType": 5126, "count": 1, "type": "SCALAR"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "byte offset past the view",
+			view:     view,
+			accessor: `{"bufferView": 0, "byteOffset": 9223372036854775807, "componentType": 5126, "count": 1, "type": "SCALAR"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "negative byte stride",
+			view:     `{"buffer": 0, "byteLength": 24, "byteStride": -12}`,
+			accessor: `{"bufferView": 0, "byteOffset": 12, "componentType": 5126, "count": 2, "type": "VEC3"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "byte stride smaller than an element",
+			view:     `{"buffer": 0, "byteLength": 24, "byteStride": 4}`,
+			accessor: `{"bufferView": 0, "componentType": 5126, "count": 2, "type": "VEC3"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "count past the view",
+			view:     view,
+			accessor: `{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "huge count",
+			view:     view,
+			accessor: `{"bufferView": 0, "componentType": 5126, "count": 4611686018427387904, "type": "VEC3"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "huge count without a buffer view",
+			view:     view,
+			accessor: `{"componentType": 5126, "count": 4611686018427387904, "type": "VEC3"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "view past the buffer",
+			view:     `{"buffer": 0, "byteOffset": 9223372036854775807, "byteLength": 9223372036854775807}`,
+			accessor: `{"bufferView": 0, "componentType": 5126, "count": 1, "type": "SCALAR"}`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := accessorLoader(t, tt.view, tt.accessor).accessor(0)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("accessor = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("accessor = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
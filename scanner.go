@@ -1,15 +1,31 @@
 package main
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 )
 
-// ScanFolder recursively walks a directory and upserts all .glb/.gltf files into the database.
+// ScanFolder recursively walks a directory and upserts every file in a registered format into the database.
 // Returns the number of assets found.
+// A folder whose root can't be reached is marked offline instead, keeping its assets.
 func ScanFolder(db *Database, folder WatchFolder) (int, error) {
+	if !db.FolderReachable(folder) {
+		if err := db.SetFolderOnline(folder.ID, false); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%s: %w", folder.Path, errFolderOffline)
+	}
+	if err := db.SetFolderOnline(folder.ID, true); err != nil {
+		return 0, err
+	}
 	count := 0
 
 	err := filepath.WalkDir(folder.Path, func(path string, d os.DirEntry, err error) error {
@@ -21,8 +37,7 @@ func ScanFolder(db *Database, folder WatchFolder) (int, error) {
 			return nil
 		}
 
-		ext := strings.ToLower(filepath.Ext(d.Name()))
-		if ext != ".glb" && ext != ".gltf" {
+		if !isAssetFile(d.Name()) {
 			return nil
 		}
 
@@ -31,7 +46,7 @@ func ScanFolder(db *Database, folder WatchFolder) (int, error) {
 			return nil // skip files we can't stat
 		}
 
-		_, err = db.UpsertAsset(path, folder.ID, info.Size(), info.ModTime())
+		_, err = IndexFile(db, folder, path, info)
 		if err != nil {
 			fmt.Printf("warn: failed to upsert %s: %v\n", path, err)
 			return nil
@@ -45,7 +60,10 @@ func ScanFolder(db *Database, folder WatchFolder) (int, error) {
 	}
 
 	// Prune assets that no longer exist on disk
-	pruned, _ := db.PruneAssetsForFolder(folder.ID)
+	pruned, err := db.PruneAssetsForFolder(folder)
+	if err != nil {
+		return count, err
+	}
 	if pruned > 0 {
 		fmt.Printf("pruned %d missing assets from %s\n", pruned, folder.Path)
 	}
@@ -53,6 +71,104 @@ func ScanFolder(db *Database, folder WatchFolder) (int, error) {
 	return count, nil
 }
 
+// IndexFile records a single asset file in the database. If the file is one we
+// already know under a different path (moved or renamed), the existing row is
+// re-pointed at the new path so its tags, trays and favorite flag survive.
+func IndexFile(db *Database, folder WatchFolder, path string, info fs.FileInfo) (*Asset, error) {
+	inode, device := fileIdentity(info)
+	modStr := info.ModTime().UTC().Format(time.RFC3339)
+
+	existing, err := db.GetAssetByPath(path)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	// A trashed asset keeps its path to be restored to. A new file there waits
+	// until the trashed one is restored or purged, so the trash isn't orphaned.
+	if existing != nil && existing.TrashedAt != "" {
+		return nil, nil
+	}
+
+	// Only re-hash when the file looks different from what we last saw
+	hash := ""
+	if existing != nil && existing.FileSize == info.Size() && existing.ModifiedAt == modStr {
+		hash, _ = db.GetContentHash(existing.ID)
+	}
+	unchanged := hash != ""
+	if !unchanged {
+		if hash, err = hashFile(path); err != nil {
+			fmt.Printf("warn: failed to hash %s: %v\n", path, err)
+		}
+	}
+
+	if existing == nil {
+		moved, err := db.FindMovedAsset(inode, device, info.Size(), hash)
+		if err != nil {
+			return nil, err
+		}
+		if moved != nil {
+			fmt.Printf("detected move: %s -> %s\n", moved.AbsolutePath, path)
+			if err := db.RelocateAsset(moved.ID, path, folder); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	asset, err := db.UpsertAsset(path, folder, info.Size(), info.ModTime(), inode, device)
+	if err != nil {
+		return nil, err
+	}
+	if !unchanged && hash != "" {
+		oldHash, _ := db.GetContentHash(asset.ID)
+		if oldHash != hash {
+			if err := db.SetContentHash(asset.ID, hash); err != nil {
+				return nil, err
+			}
+			// The old preview shows the old contents
+			if oldHash != "" {
+				db.ClearThumbnail(asset.ID)
+			}
+		}
+	}
+
+	// Extract model metadata when the file changed or the extractor has learned something new
+	format := formatForPath(path)
+	if format == nil || format.Extractor == nil {
+		return asset, nil
+	}
+	version, _ := db.GetMetadataVersion(asset.ID)
+	if unchanged && version >= format.Extractor.Version() {
+		return asset, nil
+	}
+	meta, err := format.Extractor.Extract(path)
+	if err != nil {
+		// Recording the attempt means the file is only retried once it changes
+		fmt.Printf("warn: failed to read metadata from %s: %v\n", path, err)
+		if err := db.SetMetadataVersion(asset.ID, format.Extractor.Version()); err != nil {
+			return nil, err
+		}
+		return asset, nil
+	}
+	if err := db.SetModelInfo(asset.ID, meta, format.Extractor.Version()); err != nil {
+		return nil, err
+	}
+	return db.GetAssetByID(asset.ID)
+}
+
+// hashFile returns the hex-encoded SHA-256 of a file's contents.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // ScanAllFolders scans every registered watch folder.
 func ScanAllFolders(db *Database) error {
 	folders, err := db.ListWatchFolders()
@@ -61,6 +177,10 @@ func ScanAllFolders(db *Database) error {
 	}
 	for _, f := range folders {
 		count, err := ScanFolder(db, f)
+		if errors.Is(err, errFolderOffline) {
+			fmt.Printf("%s is offline, keeping its assets\n", f.Path)
+			continue
+		}
 		if err != nil {
 			fmt.Printf("error scanning %s: %v\n", f.Path, err)
 			continue
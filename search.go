@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The asset_search FTS5 table holds one row per asset (rowid = asset id). It is
+// kept in sync by triggers, so every write path — scanning, tagging, collection
+// edits, duplicate merges, cascading deletes — updates it without extra calls.
+const searchSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS asset_search USING fts5(
+		filename,
+		folder,
+		tags,
+		collections,
+		names,
+		tokenize = 'unicode61 remove_diacritics 2',
+		prefix = '2 3'
+	);
+`
+
+// searchWeights are the bm25 weights for the asset_search columns, in order.
+const searchWeights = "10.0, 2.0, 5.0, 3.0, 1.0"
+
+// searchRefreshSQL rebuilds the search rows for the assets whose ids are selected by
+// the given SQL expression (used as the right-hand side of IN).
+func searchRefreshSQL(ids string) string {
+	return fmt.Sprintf(`
+		DELETE FROM asset_search WHERE rowid IN (%[1]s);
+		INSERT INTO asset_search (rowid, filename, folder, tags, collections, names)
+		SELECT a.id, a.filename,
+			substr(a.absolute_path, length(COALESCE(w.path, '')) + 1, length(a.absolute_path) - length(COALESCE(w.path, '')) - length(a.filename)),
+			COALESCE((SELECT group_concat(t.name, ' ') FROM asset_tags at JOIN tags t ON t.id = at.tag_id WHERE at.asset_id = a.id), ''),
+			COALESCE((SELECT group_concat(c.name, ' ') FROM collection_assets ca JOIN collections c ON c.id = ca.collection_id WHERE ca.asset_id = a.id), ''),
+			a.search_names
+		FROM assets a
+		LEFT JOIN watch_folders w ON w.id = a.folder_id
+		WHERE a.id IN (%[1]s);
+	`, ids)
+}
+
+// searchTriggers returns the triggers that keep asset_search current.
+func searchTriggers() string {
+	triggers := []struct{ name, event, ids string }{
+		{"asset_search_ai", "AFTER INSERT ON assets", "NEW.id"},
+		{"asset_search_au", "AFTER UPDATE OF absolute_path, filename, folder_id, search_names ON assets", "NEW.id"},
+		{"asset_search_tag_ai", "AFTER INSERT ON asset_tags", "NEW.asset_id"},
+		{"asset_search_tag_ad", "AFTER DELETE ON asset_tags", "OLD.asset_id"},
+		{"asset_search_tag_au", "AFTER UPDATE OF name ON tags", "SELECT asset_id FROM asset_tags WHERE tag_id = NEW.id"},
+		{"asset_search_coll_ai", "AFTER INSERT ON collection_assets", "NEW.asset_id"},
+		{"asset_search_coll_ad", "AFTER DELETE ON collection_assets", "OLD.asset_id"},
+		{"asset_search_coll_au", "AFTER UPDATE OF name ON collections", "SELECT asset_id FROM collection_assets WHERE collection_id = NEW.id"},
+	}
+	var b strings.Builder
+	for _, t := range triggers {
+		fmt.Fprintf(&b, "CREATE TRIGGER IF NOT EXISTS %s %s BEGIN %s END;\n", t.name, t.event, searchRefreshSQL(t.ids))
+	}
+	b.WriteString(`
+		CREATE TRIGGER IF NOT EXISTS asset_search_ad AFTER DELETE ON assets BEGIN
+			DELETE FROM asset_search WHERE rowid = OLD.id;
+		END;
+	`)
+	return b.String()
+}
+
+// migrateSearch adds the names column, then creates the full-text index and its
+// triggers and fills the index from existing rows.
+func migrateSearch(tx *sql.Tx) error {
+	if err := addColumn(tx, "assets", "search_names", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(searchSchema); err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+	if _, err := tx.Exec(searchTriggers()); err != nil {
+		return fmt.Errorf("create search triggers: %w", err)
+	}
+	_, err := tx.Exec(searchRefreshSQL("SELECT id FROM assets"))
+	return err
+}
+
+// SearchAssets returns assets matching a free-text query, best matches first.
+// Every word must match, either exactly or as a prefix, in any indexed field. A
+// word that is a tag alias matches the tag as well.
+func (d *Database) SearchAssets(query string) ([]Asset, error) {
+	aliases, err := d.tagAliasMap()
+	if err != nil {
+		return nil, err
+	}
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if match := ftsTermExpr(word, aliases); match != "" {
+			terms = append(terms, match)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	match := strings.Join(terms, " ")
+	return d.queryAssets(`
+		SELECT `+assetColumns+`
+		FROM asset_search s
+		JOIN assets a ON a.id = s.rowid
+		WHERE asset_search MATCH ? AND a.trashed_at = ''
+		ORDER BY bm25(asset_search, `+searchWeights+`), a.filename
+	`, match)
+}
+
+// ftsMatchExpr turns user input into an FTS5 query: each word becomes a quoted
+// prefix term, so punctuation and FTS operators in the input are taken literally.
+func ftsMatchExpr(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// ftsTermExpr is ftsMatchExpr for a single search term, widened to also match
+// the tags column for the tag the term is an alias of.
+func ftsTermExpr(term string, aliases map[string]string) string {
+	match := ftsMatchExpr(term)
+	if tag, ok := aliases[strings.ToLower(normalizeTagName(term))]; ok && match != "" {
+		match = `((` + match + `) OR tags : "` + strings.ReplaceAll(tag, `"`, `""`) + `")`
+	}
+	return match
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	stlHeaderSize   = 80
+	stlTriangleSize = 50 // normal + 3 vertices (12 float32) + attribute byte count
+)
+
+// stlExtractor reads triangle counts and bounds from binary and ASCII STL files.
+type stlExtractor struct{}
+
+func (stlExtractor) Version() int { return 1 }
+
+func (stlExtractor) Extract(path string) (*ModelInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Binary STL files may also begin with "solid", so trust the size check first
+	var header [stlHeaderSize + 4]byte
+	n, err := io.ReadFull(f, header[:])
+	if err == nil {
+		count := int64(binary.LittleEndian.Uint32(header[stlHeaderSize:]))
+		if st.Size() == stlHeaderSize+4+count*stlTriangleSize {
+			return readBinarySTL(f, count)
+		}
+	} else if err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(header[:n]), []byte("solid")) {
+		return nil, fmt.Errorf("not an STL file")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return readASCIISTL(f)
+}
+
+func readBinarySTL(r io.Reader, count int64) (*ModelInfo, error) {
+	info := &ModelInfo{
+		TriangleCount: count,
+		VertexCount:   count * 3,
+		MeshCount:     1,
+		NodeCount:     1,
+	}
+	b := newBounds()
+	br := bufio.NewReader(r)
+	var tri [stlTriangleSize]byte
+	for i := int64(0); i < count; i++ {
+		if _, err := io.ReadFull(br, tri[:]); err != nil {
+			return nil, err
+		}
+		// Skip the 12-byte normal, then read three vertices
+		for v := 0; v < 3; v++ {
+			off := 12 + v*12
+			b.addPoint(
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(tri[off:]))),
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(tri[off+4:]))),
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(tri[off+8:]))),
+			)
+		}
+	}
+	info.Bounds = b.size()
+	return info, nil
+}
+
+func readASCIISTL(r io.Reader) (*ModelInfo, error) {
+	info := &ModelInfo{}
+	b := newBounds()
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "solid":
+			info.MeshCount++
+		case "facet":
+			info.TriangleCount++
+		case "vertex":
+			info.VertexCount++
+			if len(fields) >= 4 {
+				x, ex := strconv.ParseFloat(fields[1], 64)
+				y, ey := strconv.ParseFloat(fields[2], 64)
+				z, ez := strconv.ParseFloat(fields[3], 64)
+				if ex == nil && ey == nil && ez == nil {
+					b.addPoint(x, y, z)
+				}
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	info.NodeCount = info.MeshCount
+	info.Bounds = b.size()
+	return info, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// binarySTL encodes triangles as a binary STL file. The header starts with
+// "solid", as some exporters write, to check it isn't mistaken for ASCII.
+func binarySTL(tris [][3][3]float32) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, stlHeaderSize)
+	copy(header, "solid binary")
+	buf.Write(header)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(tris)))
+	for _, tri := range tris {
+		binary.Write(&buf, binary.LittleEndian, [3]float32{}) // normal
+		binary.Write(&buf, binary.LittleEndian, tri)
+		binary.Write(&buf, binary.LittleEndian, uint16(0))
+	}
+	return buf.Bytes()
+}
+
+func TestSTLExtract(t *testing.T) {
+	want := &ModelInfo{
+		TriangleCount: 4,
+		VertexCount:   12,
+		MeshCount:     1,
+		NodeCount:     1,
+		Bounds:        [3]float64{1, 2, 3},
+	}
+	tetra := binarySTL([][3][3]float32{
+		{{0, 0, 0}, {0, 2, 0}, {1, 0, 0}},
+		{{0, 0, 0}, {1, 0, 0}, {0, 0, 3}},
+		{{0, 0, 0}, {0, 0, 3}, {0, 2, 0}},
+		{{1, 0, 0}, {0, 2, 0}, {0, 0, 3}},
+	})
+	for _, path := range []string{
+		filepath.Join("testdata", "tetra.stl"),
+		writeFixture(t, "tetra.stl", tetra),
+	} {
+		info, err := stlExtractor{}.Extract(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", path, info, want)
+		}
+	}
+}
+
+func TestSTLExtractErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty.stl", nil, "not an STL file"},
+		{"text.stl", []byte("hello"), "not an STL file"},
+		// A binary file whose size doesn't match its count, without "solid"
+		{"truncated.stl", binarySTL([][3][3]float32{{}})[5:70], "not an STL file"},
+	}
+	for _, tt := range tests {
+		_, err := stlExtractor{}.Extract(writeFixture(t, tt.name, tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tags form a hierarchy through their names: "env/kitchen/appliance" is a child
+// of "env/kitchen", which is a child of "env". Every ancestor is a tag of its own,
+// linked by parent_id, and filtering by a tag includes all of its descendants.
+
+const tagSeparator = "/"
+
+// normalizeTagName trims each segment of a tag path and drops empty ones, so
+// " style / psx/" becomes "style/psx".
+func normalizeTagName(name string) string {
+	var parts []string
+	for _, p := range strings.Split(name, tagSeparator) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, tagSeparator)
+}
+
+// tagParent returns the path of a tag's parent, or "" for a top-level tag.
+func tagParent(name string) string {
+	if i := strings.LastIndex(name, tagSeparator); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// tagLeaf returns the last segment of a tag path.
+func tagLeaf(name string) string {
+	return name[strings.LastIndex(name, tagSeparator)+1:]
+}
+
+// tagSubtreeSQL selects the ids of the tags selected by seed, a query for tag
+// ids, and of all their descendants.
+func tagSubtreeSQL(seed string) string {
+	return `WITH RECURSIVE subtree(id) AS (
+			` + seed + `
+			UNION SELECT t.id FROM tags t JOIN subtree ON t.parent_id = subtree.id
+		) SELECT id FROM subtree`
+}
+
+// tagsNamedSQL selects the ids of the tags named by its n arguments, either by
+// their own name or by an alias.
+func tagsNamedSQL(n int) string {
+	return `SELECT t.id FROM (VALUES ` + strings.TrimSuffix(strings.Repeat("(?),", n), ",") + `) v
+			JOIN tags t ON t.name = v.column1 COLLATE NOCASE
+				OR t.id IN (SELECT tag_id FROM tag_aliases WHERE alias = v.column1)`
+}
+
+// dbExecer is a *sql.DB or *sql.Tx.
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ensureTag returns the id of the tag with a normalized name, creating it and
+// any missing ancestors and linking it to its parent. Names match regardless of
+// case, so "Rock" finds "rock", and new tags keep their ancestors' spelling.
+func ensureTag(db dbExecer, name string) (int64, error) {
+	var parentID interface{}
+	if parent := tagParent(name); parent != "" {
+		id, err := ensureTag(db, parent)
+		if err != nil {
+			return 0, err
+		}
+		var parentName string
+		if err := db.QueryRow("SELECT name FROM tags WHERE id = ?", id).Scan(&parentName); err != nil {
+			return 0, err
+		}
+		name = parentName + name[len(parent):]
+		parentID = id
+	}
+
+	var id int64
+	err := db.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", name).Scan(&id)
+	if err == nil {
+		_, err = db.Exec("UPDATE tags SET parent_id = ? WHERE id = ?", parentID, id)
+		return id, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	res, err := db.Exec("INSERT INTO tags (name, parent_id) VALUES (?, ?)", name, parentID)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// renameTagTree renames a tag along with the paths of its descendants, moving it
+// under the parent its new name implies, and updates smart tray queries to match.
+func renameTagTree(tx *sql.Tx, id int64, from, to string) error {
+	var parentID interface{}
+	if parent := tagParent(to); parent != "" {
+		pid, err := ensureTag(tx, parent)
+		if err != nil {
+			return err
+		}
+		parentID = pid
+	}
+
+	rows, err := tx.Query("SELECT id, name FROM tags WHERE substr(name, 1, length(?)) = ?", from+tagSeparator, from+tagSeparator)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type rename struct {
+		id       int64
+		from, to string
+	}
+	renames := []rename{{id, from, to}}
+	for rows.Next() {
+		r := rename{}
+		if err := rows.Scan(&r.id, &r.from); err != nil {
+			return err
+		}
+		r.to = to + strings.TrimPrefix(r.from, from)
+		renames = append(renames, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("UPDATE tags SET parent_id = ? WHERE id = ?", parentID, id); err != nil {
+		return err
+	}
+	for _, r := range renames {
+		if _, err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", r.to, r.id); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				return fmt.Errorf("a tag named %q already exists; merge into it instead", r.to)
+			}
+			return err
+		}
+		if err := renameTagInSmartCollections(tx, []string{r.from}, r.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeTag folds a tag into the target: its assets get the target tag, its
+// children move under the target (merging into same-named children already
+// there), smart trays follow, and the tag is deleted.
+func mergeTag(tx *sql.Tx, id, targetID int64) error {
+	var name, target string
+	if err := tx.QueryRow("SELECT name FROM tags WHERE id = ?", id).Scan(&name); err != nil {
+		return fmt.Errorf("tag %d: %w", id, err)
+	}
+	if err := tx.QueryRow("SELECT name FROM tags WHERE id = ?", targetID).Scan(&target); err != nil {
+		return fmt.Errorf("merge target %d: %w", targetID, err)
+	}
+	if strings.HasPrefix(target, name+tagSeparator) {
+		return fmt.Errorf("can't merge %q into its own sub-tag %q", name, target)
+	}
+
+	rows, err := tx.Query("SELECT id, name FROM tags WHERE parent_id = ?", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	children := map[int64]string{}
+	for rows.Next() {
+		var childID int64
+		var childName string
+		if err := rows.Scan(&childID, &childName); err != nil {
+			return err
+		}
+		children[childID] = childName
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for childID, childName := range children {
+		moved := target + tagSeparator + tagLeaf(childName)
+		var existing int64
+		err := tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", moved).Scan(&existing)
+		switch {
+		case err == nil:
+			err = mergeTag(tx, childID, existing)
+		case errors.Is(err, sql.ErrNoRows):
+			err = renameTagTree(tx, childID, childName, moved)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT OR IGNORE INTO asset_tags (asset_id, tag_id) SELECT asset_id, ? FROM asset_tags WHERE tag_id = ?", targetID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE tag_aliases SET tag_id = ? WHERE tag_id = ?", targetID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+		return err
+	}
+	return renameTagInSmartCollections(tx, []string{name}, target)
+}
+
+// TagNode is a tag in the tag tree.
+type TagNode struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`  // full path, e.g. "style/psx"
+	Label string `json:"label"` // last segment, e.g. "psx"
+	// Count is the number of assets with this tag or any of its descendants.
+	Count    int       `json:"count"`
+	Children []TagNode `json:"children"`
+}
+
+// ListTagTree returns the top-level tags with their descendants nested beneath
+// them, each level sorted by name.
+func (d *Database) ListTagTree() ([]TagNode, error) {
+	tags, err := d.ListTagsWithCounts()
+	if err != nil {
+		return nil, err
+	}
+	children := map[int64][]TagWithCount{}
+	for _, t := range tags {
+		children[t.ParentID] = append(children[t.ParentID], t)
+	}
+	var build func(parent int64) []TagNode
+	build = func(parent int64) []TagNode {
+		nodes := []TagNode{}
+		for _, t := range children[parent] {
+			nodes = append(nodes, TagNode{ID: t.ID, Name: t.Name, Label: tagLeaf(t.Name), Count: t.Count, Children: build(t.ID)})
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			return strings.ToLower(nodes[i].Label) < strings.ToLower(nodes[j].Label)
+		})
+		return nodes
+	}
+	return build(0), nil
+}
+
+// migrateTagHierarchy adds parent links and links up existing tags whose names
+// are already paths, creating their ancestors. Names that normalize onto an
+// existing tag are merged into it.
+func migrateTagHierarchy(tx *sql.Tx) error {
+	if err := addColumn(tx, "tags", "parent_id", "INTEGER REFERENCES tags(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_tags_parent ON tags(parent_id);
+		CREATE INDEX IF NOT EXISTS idx_asset_tags_tag ON asset_tags(tag_id);
+	`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, name FROM tags WHERE instr(name, ?) > 0", tagSeparator)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	paths := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		paths[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, name := range paths {
+		clean := normalizeTagName(name)
+		if clean == "" {
+			continue
+		}
+		target, err := ensureTag(tx, clean)
+		if err != nil {
+			return err
+		}
+		if target != id {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO asset_tags (asset_id, tag_id) SELECT asset_id, ? FROM asset_tags WHERE tag_id = ?", target, id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+	}
+	if len(paths) > 0 {
+		fmt.Printf("[db] linked %d tag paths into the tag hierarchy\n", len(paths))
+	}
+	return nil
+}
+
+// --- Aliases ---
+
+// A tag alias is another name for a tag: tagging with the alias applies the tag
+// instead, and searching for it finds the tag's assets. Aliases are unique
+// regardless of case and never coincide with a tag's own name.
+
+// TagAlias is an alternative name for a tag.
+type TagAlias struct {
+	Alias   string `json:"alias"`
+	TagID   int64  `json:"tag_id"`
+	TagName string `json:"tag_name"`
+}
+
+// resolveTagAlias replaces the longest leading part of a tag path that is an
+// alias with the name of its tag, so with "trees" an alias of "nature/tree",
+// "trees/oak" becomes "nature/tree/oak".
+func resolveTagAlias(db dbExecer, name string) (string, error) {
+	for prefix := name; prefix != ""; prefix = tagParent(prefix) {
+		var canonical string
+		err := db.QueryRow(`
+			SELECT t.name FROM tag_aliases al JOIN tags t ON t.id = al.tag_id
+			WHERE al.alias = ?
+		`, prefix).Scan(&canonical)
+		if err == nil {
+			return canonical + strings.TrimPrefix(name, prefix), nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// AddTagAlias makes alias another name for a tag. An existing tag with that name
+// is merged into the tag first, so its assets and sub-tags carry over.
+func (d *Database) AddTagAlias(alias string, tagID int64) error {
+	alias = normalizeTagName(alias)
+	if alias == "" {
+		return errors.New("alias can't be empty")
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing int64
+	err = tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", alias).Scan(&existing)
+	switch {
+	case err == nil && existing == tagID:
+		return fmt.Errorf("%q is the tag's own name", alias)
+	case err == nil:
+		if err := mergeTag(tx, existing, tagID); err != nil {
+			return err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO tag_aliases (alias, tag_id) VALUES (?, ?)
+		ON CONFLICT(alias) DO UPDATE SET tag_id = excluded.tag_id
+	`, alias, tagID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveTagAlias deletes an alias. The tag itself is untouched.
+func (d *Database) RemoveTagAlias(alias string) error {
+	_, err := d.db.Exec("DELETE FROM tag_aliases WHERE alias = ?", normalizeTagName(alias))
+	return err
+}
+
+// ListTagAliases returns every alias, sorted by the name of its tag.
+func (d *Database) ListTagAliases() ([]TagAlias, error) {
+	rows, err := d.db.Query(`
+		SELECT al.alias, t.id, t.name FROM tag_aliases al JOIN tags t ON t.id = al.tag_id
+		ORDER BY t.name, al.alias
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []TagAlias
+	for rows.Next() {
+		var a TagAlias
+		if err := rows.Scan(&a.Alias, &a.TagID, &a.TagName); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// tagAliasMap maps each lowercased alias to the name of its tag.
+func (d *Database) tagAliasMap() (map[string]string, error) {
+	aliases, err := d.ListTagAliases()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		m[strings.ToLower(a.Alias)] = a.TagName
+	}
+	return m, nil
+}
+
+func migrateTagAliases(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_aliases (
+			alias  TEXT    PRIMARY KEY COLLATE NOCASE,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_tag_aliases_tag ON tag_aliases(tag_id);
+	`)
+	return err
+}
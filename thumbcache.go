@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// thumbnailTypes are the image formats the thumbnail cache stores, by extension.
+var thumbnailTypes = map[string]string{
+	".png":  "image/png",
+	".webp": "image/webp",
+	".jpg":  "image/jpeg",
+}
+
+// ThumbnailCache stores rendered previews as image files in one directory.
+//
+// Files are named {asset id}-{content hash prefix}-{render stamp}[-{kind}].{ext},
+// so an image is tied to the exact file contents it was rendered from and every
+// re-render gets a fresh name that browsers can cache forever. The main thumbnail
+// has no kind; extra views such as the turntable sheet do.
+type ThumbnailCache struct {
+	dir string
+}
+
+func NewThumbnailCache(dir string) *ThumbnailCache {
+	os.MkdirAll(dir, 0755)
+	return &ThumbnailCache{dir: dir}
+}
+
+// Write stores an image for an asset and returns its cache key. kind is "" for
+// the main thumbnail.
+func (c *ThumbnailCache) Write(assetID int64, contentHash, kind string, data []byte, ext string) (string, error) {
+	if _, ok := thumbnailTypes[ext]; !ok {
+		return "", fmt.Errorf("unsupported thumbnail type %q", ext)
+	}
+	hash := contentHash
+	if len(hash) > 16 {
+		hash = hash[:16]
+	}
+	if hash == "" {
+		hash = "0"
+	}
+	key := fmt.Sprintf("%d-%s-%s", assetID, hash, strconv.FormatInt(time.Now().UnixNano(), 36))
+	if kind != "" {
+		key += "-" + kind
+	}
+	key += ext
+
+	// Write to a temp file first so the server never sees a half-written image
+	tmp := filepath.Join(c.dir, "."+key+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, key)); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return key, nil
+}
+
+// Path returns the file for a cache key, rejecting anything that isn't a plain
+// file name of a known image type.
+func (c *ThumbnailCache) Path(key string) (string, bool) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", false
+	}
+	if _, ok := thumbnailTypes[strings.ToLower(filepath.Ext(key))]; !ok {
+		return "", false
+	}
+	return filepath.Join(c.dir, key), true
+}
+
+// Remove deletes a cached image. Missing files are not an error.
+func (c *ThumbnailCache) Remove(key string) {
+	if p, ok := c.Path(key); ok {
+		os.Remove(p)
+	}
+}
+
+// Prune deletes every cached file whose key isn't in keep, returning how many went.
+// Files written since before, and temp files of writes still in progress, are
+// left alone: their keys may not have been saved yet.
+func (c *ThumbnailCache) Prune(keep map[string]bool, before time.Time) int {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || keep[e.Name()] || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		if info, err := e.Info(); err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if os.Remove(filepath.Join(c.dir, e.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// decodeDataURL decodes a base64 image as produced by canvas.toDataURL, returning
+// the bytes and a file extension. Bare base64 without a data: prefix is taken as PNG.
+func decodeDataURL(s string) ([]byte, string, error) {
+	ext := ".png"
+	if rest, ok := strings.CutPrefix(s, "data:"); ok {
+		meta, payload, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, "", errors.New("not a base64 data URL")
+		}
+		mime := strings.TrimSuffix(meta, ";base64")
+		ext = ""
+		for e, m := range thumbnailTypes {
+			if m == mime {
+				ext = e
+			}
+		}
+		if ext == "" {
+			return nil, "", fmt.Errorf("unsupported thumbnail type %q", mime)
+		}
+		s = payload
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode thumbnail: %w", err)
+	}
+	return data, ext, nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Thumbnail renderer modes, stored under settingThumbnailRenderer.
+const (
+	// ThumbnailsAuto renders thumbnails in the webview with WebGL, and falls back
+	// to the CPU renderer when the webview has no WebGL.
+	ThumbnailsAuto = "auto"
+	// ThumbnailsCPU always renders thumbnails in the background on the CPU.
+	ThumbnailsCPU = "cpu"
+
+	settingThumbnailRenderer = "thumbnail_renderer"
+	settingPreviews          = "previews"
+	settingTurntableFrames   = "turntable_frames"
+)
+
+// thumbnailSize is the side of a rendered thumbnail, matching thumbnails.ts.
+// Preview frames are the same size.
+const thumbnailSize = 256
+
+// Turntable frame counts allowed in PreviewSettings.
+const (
+	defaultTurntableFrames = 12
+	minTurntableFrames     = 4
+	maxTurntableFrames     = 36
+)
+
+// PreviewSettings controls the optional turntable and orthographic previews.
+type PreviewSettings struct {
+	Enabled bool `json:"enabled"`
+	Frames  int  `json:"frames"`
+}
+
+// ThumbnailReadyEvent is emitted when a background render finishes.
+type ThumbnailReadyEvent struct {
+	AssetID   int64  `json:"asset_id"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+// ThumbnailRenderer renders missing glTF thumbnails and previews on a pool of
+// background workers with the software rasterizer. Thumbnails are only rendered
+// once activated, so the webview's WebGL renderer stays in charge where it works;
+// previews are rendered whenever they are turned on.
+type ThumbnailRenderer struct {
+	db   *Database
+	emit func(name string, data interface{})
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active bool
+	// frames is the turntable length, or 0 when previews are off.
+	frames  int
+	closed  bool
+	pending []int64
+	queued  map[int64]bool
+	// failed holds assets whose render failed this session, so every rescan
+	// doesn't retry them. Regenerating thumbnails clears it.
+	failed   map[int64]bool
+	busy     int
+	rendered int
+	started  time.Time
+	wg       sync.WaitGroup
+}
+
+// NewThumbnailRenderer starts the worker pool, using half the CPUs so the UI and
+// scanner stay responsive.
+func NewThumbnailRenderer(db *Database, emit func(name string, data interface{})) *ThumbnailRenderer {
+	r := &ThumbnailRenderer{
+		db:     db,
+		emit:   emit,
+		queued: make(map[int64]bool),
+		failed: make(map[int64]bool),
+	}
+	r.cond = sync.NewCond(&r.mu)
+	workers := max(1, runtime.NumCPU()/2)
+	r.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go r.worker()
+	}
+	return r
+}
+
+// Activate turns on background rendering and queues everything that is missing.
+func (r *ThumbnailRenderer) Activate() int {
+	r.mu.Lock()
+	r.active = true
+	r.mu.Unlock()
+	return r.QueueMissing()
+}
+
+// Deactivate stops rendering thumbnails. Queued assets still get their previews.
+func (r *ThumbnailRenderer) Deactivate() {
+	r.mu.Lock()
+	r.active = false
+	r.mu.Unlock()
+}
+
+// SetPreviewFrames turns previews on with a turntable of the given length, or off
+// for 0, and queues the assets that need (re-)rendering.
+func (r *ThumbnailRenderer) SetPreviewFrames(frames int) int {
+	r.mu.Lock()
+	r.frames = frames
+	r.mu.Unlock()
+	return r.QueueMissing()
+}
+
+// QueueMissing queues every renderable asset that lacks a thumbnail (while
+// active) or previews (while they are on), returning how many were added.
+func (r *ThumbnailRenderer) QueueMissing() int {
+	r.mu.Lock()
+	active, frames := r.active, r.frames
+	r.mu.Unlock()
+
+	var ids []int64
+	if active {
+		missing, err := r.db.MissingThumbnails(canRasterize)
+		if err != nil {
+			fmt.Printf("[thumbs] warn: list missing thumbnails: %v\n", err)
+		}
+		ids = append(ids, missing...)
+	}
+	if frames > 0 {
+		missing, err := r.db.MissingPreviews(frames, canRasterize)
+		if err != nil {
+			fmt.Printf("[thumbs] warn: list missing previews: %v\n", err)
+		}
+		ids = append(ids, missing...)
+	}
+	if len(ids) == 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	added := 0
+	for _, id := range ids {
+		if r.queued[id] || r.failed[id] {
+			continue
+		}
+		r.queued[id] = true
+		r.pending = append(r.pending, id)
+		added++
+	}
+	if added > 0 {
+		if r.busy == 0 && r.rendered == 0 {
+			r.started = time.Now()
+		}
+		fmt.Printf("[thumbs] queued %d assets\n", added)
+		r.cond.Broadcast()
+	}
+	return added
+}
+
+// RetryFailed forgets earlier failures so they are attempted again.
+func (r *ThumbnailRenderer) RetryFailed() {
+	r.mu.Lock()
+	r.failed = make(map[int64]bool)
+	r.mu.Unlock()
+}
+
+// Close stops the workers, waiting for renders in progress to finish.
+func (r *ThumbnailRenderer) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+func (r *ThumbnailRenderer) worker() {
+	defer r.wg.Done()
+	for {
+		r.mu.Lock()
+		for len(r.pending) == 0 && !r.closed {
+			r.cond.Wait()
+		}
+		if r.closed {
+			r.mu.Unlock()
+			return
+		}
+		id := r.pending[0]
+		r.pending = r.pending[1:]
+		r.busy++
+		r.mu.Unlock()
+
+		ok := r.render(id)
+
+		r.mu.Lock()
+		r.busy--
+		delete(r.queued, id)
+		if ok {
+			r.rendered++
+		} else {
+			r.failed[id] = true
+		}
+		if len(r.pending) == 0 && r.busy == 0 && r.rendered > 0 {
+			fmt.Printf("[thumbs] rendered %d assets in %s\n", r.rendered, time.Since(r.started).Round(time.Millisecond))
+			r.rendered = 0
+		}
+		r.mu.Unlock()
+	}
+}
+
+// render draws whatever an asset is missing, reporting whether it succeeded.
+// Assets that were deleted or got a thumbnail some other way in the meantime
+// count as done. A panic while loading or drawing a malformed file fails just
+// that asset.
+func (r *ThumbnailRenderer) render(id int64) (ok bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Printf("[thumbs] warn: render asset %d: panic: %v\n", id, p)
+			ok = false
+		}
+	}()
+
+	r.mu.Lock()
+	active, frames := r.active, r.frames
+	r.mu.Unlock()
+
+	asset, err := r.db.GetAssetByID(id)
+	if err != nil {
+		return true
+	}
+	needThumbnail := active && asset.Thumbnail == ""
+	needPreviews := frames > 0 && !r.db.HasPreviews(id, frames)
+	if !needThumbnail && !needPreviews {
+		return true
+	}
+
+	scene, err := loadRasterScene(asset.AbsolutePath)
+	if err == nil && len(scene.prims) == 0 {
+		err = errors.New("no triangles to draw")
+	}
+	if err != nil {
+		fmt.Printf("[thumbs] warn: render %s: %v\n", asset.AbsolutePath, err)
+		return false
+	}
+
+	if needThumbnail {
+		data, err := encodePNG(scene.thumbnail(thumbnailSize))
+		if err == nil {
+			err = r.db.SetThumbnailImage(id, data, ".png")
+		}
+		if err != nil {
+			fmt.Printf("[thumbs] warn: save thumbnail for %s: %v\n", asset.AbsolutePath, err)
+			return false
+		}
+		url, _ := r.db.GetThumbnail(id)
+		r.emit(EventThumbnailReady, ThumbnailReadyEvent{AssetID: id, Thumbnail: url})
+	}
+
+	if needPreviews {
+		turntable, err := encodePNG(scene.turntable(thumbnailSize, frames))
+		if err != nil {
+			fmt.Printf("[thumbs] warn: encode turntable for %s: %v\n", asset.AbsolutePath, err)
+			return false
+		}
+		views, err := encodePNG(scene.orthoViews(thumbnailSize))
+		if err == nil {
+			err = r.db.SetPreviews(id, turntable, frames, views)
+		}
+		if err != nil {
+			fmt.Printf("[thumbs] warn: save previews for %s: %v\n", asset.AbsolutePath, err)
+			return false
+		}
+		if p, err := r.db.GetPreviews(id); err == nil {
+			r.emit(EventPreviewsReady, p)
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Deleting an asset moves its file into the trash instead of removing it. The
+// trash is laid out like a freedesktop.org trash — files/ holds the files and
+// info/ a .trashinfo for each recording where it came from — and the asset row
+// stays, marked trashed, so restoring it brings back its tags and trays.
+
+// moveToTrash moves a file into the trash and returns its path there.
+func moveToTrash(path string) (string, error) {
+	filesDir := filepath.Join(trashDir(), "files")
+	infoDir := filepath.Join(trashDir(), "info")
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(infoDir, 0700); err != nil {
+		return "", err
+	}
+
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), i, ext)
+		}
+		// Creating the info file first reserves the name
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		info, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		dest := filepath.Join(filesDir, name)
+		if _, err := os.Lstat(dest); err == nil {
+			info.Close()
+			os.Remove(infoPath)
+			continue
+		}
+		_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: filepath.ToSlash(path)}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if cerr := info.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = moveFile(path, dest)
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+// restoreFromTrash moves a trashed file back to its original path.
+func restoreFromTrash(trashPath, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(trashPath, path); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("the file is no longer in the trash")
+		}
+		return err
+	}
+	os.Remove(trashInfoPath(trashPath))
+	return nil
+}
+
+// removeFromTrash deletes a trashed file for good (best-effort).
+func removeFromTrash(trashPath string) {
+	os.Remove(trashPath)
+	os.Remove(trashInfoPath(trashPath))
+}
+
+// trashInfoPath returns the .trashinfo that goes with a file in the trash.
+func trashInfoPath(trashPath string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(trashPath)), "info", filepath.Base(trashPath)+".trashinfo")
+}
+
+// moveFile renames a file, copying it when the destination is on another device.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || os.IsNotExist(err) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// --- Database ---
+
+// TrashAsset marks an asset as trashed, its file now at trashPath, which hides it
+// everywhere but the trash. Its tags and trays are kept.
+func (d *Database) TrashAsset(id int64, trashPath string) error {
+	nowStr := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.db.Exec("UPDATE assets SET trashed_at = ?, trash_path = ? WHERE id = ?", nowStr, trashPath, id)
+	return err
+}
+
+// RestoreAsset clears an asset's trashed state.
+func (d *Database) RestoreAsset(id int64) error {
+	_, err := d.db.Exec("UPDATE assets SET trashed_at = '', trash_path = '' WHERE id = ?", id)
+	return err
+}
+
+// GetTrashPath returns where a trashed asset's file is, or "" if the asset isn't
+// trashed.
+func (d *Database) GetTrashPath(id int64) (string, error) {
+	var p string
+	err := d.db.QueryRow("SELECT trash_path FROM assets WHERE id = ?", id).Scan(&p)
+	return p, err
+}
+
+// PurgeTrash deletes every trashed asset row and returns the trash paths of
+// their files.
+func (d *Database) PurgeTrash() ([]string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT trash_path FROM assets WHERE trashed_at != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("DELETE FROM assets WHERE trashed_at != ''"); err != nil {
+		return nil, err
+	}
+	return paths, tx.Commit()
+}
+
+func migrateRecycleBin(tx *sql.Tx) error {
+	if err := addColumns(tx, "assets",
+		"trashed_at TEXT NOT NULL DEFAULT ''",
+		"trash_path TEXT NOT NULL DEFAULT ''",
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_assets_trashed ON assets(trashed_at) WHERE trashed_at != ''")
+	return err
+}
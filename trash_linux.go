@@ -0,0 +1,9 @@
+package main
+
+import "path/filepath"
+
+// trashDir returns the freedesktop.org home trash, so deleted assets show up in
+// the desktop's own trash as well.
+func trashDir() string {
+	return filepath.Join(filepath.Dir(dataDir()), "Trash")
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "path/filepath"
+
+// trashDir returns sushi's own trash next to the database; the macOS and Windows
+// trashes have no file-level interface to move files in and out of.
+func trashDir() string {
+	return filepath.Join(dataDir(), "trash")
+}
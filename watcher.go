@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDebounce is how long a folder must be quiet before queued events are applied.
+	watchDebounce = 500 * time.Millisecond
+	// watchRetryInterval is how often an unreachable (e.g. unmounted) root is re-checked.
+	watchRetryInterval = 5 * time.Second
+)
+
+// Runtime event names emitted to the frontend.
+const (
+	EventAssetsChanged  = "assets:changed"
+	EventFolderStatus   = "folder:status"
+	EventThumbnailReady = "thumbnail:ready"
+	EventPreviewsReady  = "previews:ready"
+)
+
+// AssetsChangedEvent describes a batch of filesystem changes applied to the database.
+type AssetsChangedEvent struct {
+	FolderID int64    `json:"folder_id"`
+	Upserted []Asset  `json:"upserted"`
+	Removed  []string `json:"removed"`
+}
+
+// FolderStatusEvent is emitted when a watch folder's root goes away or comes back.
+type FolderStatusEvent struct {
+	FolderID int64 `json:"folder_id"`
+	Online   bool  `json:"online"`
+}
+
+// WatchManager owns one FolderWatcher per registered watch folder.
+type WatchManager struct {
+	db   *Database
+	emit func(name string, data interface{})
+
+	mu       sync.Mutex
+	watchers map[int64]*FolderWatcher
+}
+
+// NewWatchManager creates a manager that applies changes to db and reports them through emit.
+func NewWatchManager(db *Database, emit func(name string, data interface{})) *WatchManager {
+	return &WatchManager{
+		db:       db,
+		emit:     emit,
+		watchers: make(map[int64]*FolderWatcher),
+	}
+}
+
+// WatchAll starts watchers for every registered watch folder.
+func (m *WatchManager) WatchAll() error {
+	folders, err := m.db.ListWatchFolders()
+	if err != nil {
+		return err
+	}
+	for _, f := range folders {
+		m.Watch(f)
+	}
+	return nil
+}
+
+// Watch starts watching a folder. It is a no-op if the folder is already watched.
+func (m *WatchManager) Watch(folder WatchFolder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.watchers[folder.ID]; ok {
+		return
+	}
+	fw := &FolderWatcher{
+		db:      m.db,
+		folder:  folder,
+		emit:    m.emit,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	m.watchers[folder.ID] = fw
+	go fw.run()
+}
+
+// Unwatch stops watching a folder and waits for its watcher to exit.
+func (m *WatchManager) Unwatch(folderID int64) {
+	m.mu.Lock()
+	fw, ok := m.watchers[folderID]
+	delete(m.watchers, folderID)
+	m.mu.Unlock()
+
+	if ok {
+		fw.stop()
+	}
+}
+
+// Close stops all watchers.
+func (m *WatchManager) Close() {
+	m.mu.Lock()
+	watchers := m.watchers
+	m.watchers = make(map[int64]*FolderWatcher)
+	m.mu.Unlock()
+
+	for _, fw := range watchers {
+		fw.stop()
+	}
+}
+
+// FolderWatcher applies inotify events for a single watch folder tree to the database.
+type FolderWatcher struct {
+	db     *Database
+	folder WatchFolder
+	emit   func(name string, data interface{})
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (fw *FolderWatcher) stop() {
+	close(fw.done)
+	<-fw.stopped
+}
+
+// run attaches to the folder tree and processes events until stopped. If the root
+// disappears (deleted, or its drive unmounted) it marks the folder offline, waits
+// for it to come back and rescans.
+func (fw *FolderWatcher) run() {
+	defer close(fw.stopped)
+
+	online := fw.folder.OfflineSince == ""
+	for {
+		w, err := fw.attach()
+		if err != nil {
+			if online {
+				fmt.Printf("[watcher] %s unavailable: %v\n", fw.folder.Path, err)
+				online = false
+				fw.setOnline(false)
+			}
+			select {
+			case <-fw.done:
+				return
+			case <-time.After(watchRetryInterval):
+				continue
+			}
+		}
+
+		if !online {
+			online = true
+			fmt.Printf("[watcher] %s is back, rescanning\n", fw.folder.Path)
+			fw.setOnline(true)
+			fw.rescan()
+		}
+
+		lost := fw.loop(w)
+		w.Close()
+		if !lost {
+			return
+		}
+	}
+}
+
+// attach creates an inotify watcher covering the root and all of its subdirectories.
+func (fw *FolderWatcher) attach() (*fsnotify.Watcher, error) {
+	if !fw.rootReachable() {
+		return nil, fmt.Errorf("root %s is not a reachable directory", fw.folder.Path)
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.addTree(w, fw.folder.Path, nil); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// loop collects events and applies them once the folder has been quiet for
+// watchDebounce. It returns true if the root was lost and the watcher should re-attach.
+func (fw *FolderWatcher) loop(w *fsnotify.Watcher) bool {
+	pending := make(map[string]struct{})
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-fw.done:
+			return false
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return false
+			}
+			if ev.Has(fsnotify.Chmod) && !ev.Has(fsnotify.Write) {
+				continue
+			}
+			pending[ev.Name] = struct{}{}
+			debounce = time.After(watchDebounce)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return false
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events were dropped — fall back to a full rescan.
+				fmt.Printf("[watcher] %s: event queue overflowed, rescanning\n", fw.folder.Path)
+				pending = make(map[string]struct{})
+				fw.rescan()
+				continue
+			}
+			fmt.Printf("[watcher] %s: %v\n", fw.folder.Path, err)
+
+		case <-debounce:
+			debounce = nil
+			if !fw.rootReachable() {
+				return true
+			}
+			fw.flush(w, pending)
+			pending = make(map[string]struct{})
+		}
+	}
+}
+
+// flush applies a batch of changed paths to the database and notifies the frontend.
+func (fw *FolderWatcher) flush(w *fsnotify.Watcher, paths map[string]struct{}) {
+	ev := AssetsChangedEvent{FolderID: fw.folder.ID}
+
+	// Index paths that exist before handling ones that vanished, so that the new
+	// half of a rename claims the existing row before the old half deletes it.
+	var gone []string
+	for path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			gone = append(gone, path)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if info.IsDir() {
+			// New or moved-in directory: watch it and index anything already inside.
+			fw.addTree(w, path, func(p string, fi fs.FileInfo) {
+				if a := fw.upsert(p, fi); a != nil {
+					ev.Upserted = append(ev.Upserted, *a)
+				}
+			})
+			continue
+		}
+		if !isAssetFile(path) {
+			continue
+		}
+		if a := fw.upsert(path, info); a != nil {
+			ev.Upserted = append(ev.Upserted, *a)
+		}
+	}
+
+	for _, path := range gone {
+		// Deleted or renamed away. The path may have been a file or a directory.
+		if isAssetFile(path) {
+			if err := fw.db.DeleteAssetByPath(path); err != nil {
+				fmt.Printf("warn: failed to delete %s: %v\n", path, err)
+			} else {
+				ev.Removed = append(ev.Removed, path)
+			}
+		}
+		removed, err := fw.db.DeleteAssetsUnderDir(path)
+		if err != nil {
+			fmt.Printf("warn: failed to delete assets under %s: %v\n", path, err)
+		}
+		ev.Removed = append(ev.Removed, removed...)
+	}
+
+	if len(ev.Upserted) > 0 || len(ev.Removed) > 0 {
+		fmt.Printf("[watcher] %s: %d updated, %d removed\n", fw.folder.Path, len(ev.Upserted), len(ev.Removed))
+		fw.emit(EventAssetsChanged, ev)
+	}
+}
+
+func (fw *FolderWatcher) upsert(path string, info fs.FileInfo) *Asset {
+	a, err := IndexFile(fw.db, fw.folder, path, info)
+	if err != nil {
+		fmt.Printf("warn: failed to upsert %s: %v\n", path, err)
+		return nil
+	}
+	return a
+}
+
+// addTree adds inotify watches for dir and every directory beneath it. If onFile is
+// non-nil it is called for each asset file found along the way.
+func (fw *FolderWatcher) addTree(w *fsnotify.Watcher, dir string, onFile func(string, fs.FileInfo)) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			// Skip directories we can't read
+			return nil
+		}
+		if d.IsDir() {
+			if err := w.Add(path); err != nil {
+				fmt.Printf("[watcher] cannot watch %s: %v\n", path, err)
+			}
+			return nil
+		}
+		if onFile == nil || !isAssetFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		onFile(path, info)
+		return nil
+	})
+}
+
+// rescan runs a full ScanFolder and tells the frontend to reload everything for this folder.
+func (fw *FolderWatcher) rescan() {
+	if _, err := ScanFolder(fw.db, fw.folder); err != nil {
+		fmt.Printf("[watcher] rescan %s: %v\n", fw.folder.Path, err)
+		return
+	}
+	fw.emit(EventAssetsChanged, AssetsChangedEvent{FolderID: fw.folder.ID})
+}
+
+func (fw *FolderWatcher) rootReachable() bool {
+	return fw.db.FolderReachable(fw.folder)
+}
+
+// setOnline records the folder's status and tells the frontend.
+func (fw *FolderWatcher) setOnline(online bool) {
+	if err := fw.db.SetFolderOnline(fw.folder.ID, online); err != nil {
+		fmt.Printf("[watcher] warn: mark %s online=%v: %v\n", fw.folder.Path, online, err)
+	}
+	fw.emit(EventFolderStatus, FolderStatusEvent{FolderID: fw.folder.ID, Online: online})
+}